@@ -1,12 +1,42 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"os"
 
 	"github.com/kirochk4/goeule/eule"
 )
 
 func main() {
-	src, _ := os.ReadFile("script.eul")
-	eule.NewInterpreter().Interpret(src)
+	vm := flag.Bool("vm", false, "run script on bytecode virtual machine")
+	var options eule.Options
+	flag.BoolVar(&options.AutoSemicolons, "semicolons", false, "insert semicolons at line ends")
+	flag.BoolVar(&options.ObjectOriented, "oop", false, "allow class syntax")
+	flag.BoolVar(&options.ArrowFunctions, "arrow", false, "allow arrow functions")
+	flag.BoolVar(&options.PrintTokens, "tokens", false, "print scanned tokens")
+	flag.BoolVar(&options.PrintAst, "ast", false, "print parsed syntax tree")
+	flag.BoolVar(&options.PrintCode, "code", false, "print compiled bytecode")
+	flag.Parse()
+
+	path := "script.eul"
+	if flag.NArg() != 0 {
+		path = flag.Arg(0)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer file.Close()
+
+	it := eule.NewInterpreter(options)
+	if *vm {
+		it.SetBackend(eule.BackendVM)
+	}
+	if _, err := it.InterpretReader(path, file); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
 }
@@ -1,7 +1,16 @@
 package eule
 
+import (
+	"cmp"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
 type astNode interface {
 	astNodeMark()
+	nodeSpan() span
+	setSpan(span)
 }
 
 type astDecl interface {
@@ -21,74 +30,121 @@ type astExpr interface {
 
 type block = []astDecl
 
+func (s span) nodeSpan() span      { return s }
+func (s *span) setSpan(other span) { *s = other }
+
 /* == declarations ========================================================== */
 
 type errorDecl struct {
+	span
 	err error
 }
 
 type varDecl = struct {
+	span
 	name varName
 	init astExpr
+	slot int // Resolved slot, -1 for globals.
 }
 type variableDecl struct {
+	span
 	vars []varDecl
 }
 
 type functionDecl struct {
+	span
 	name     varName
 	function *functionLit
+	slot     int // Resolved slot, -1 for globals.
 }
 
 type stmtDecl struct {
+	span
 	stmt astStmt
 }
 
 /* == statements ============================================================ */
 
 type blockStmt struct {
+	span
 	block
+	slots int // Scope size.
 }
 
-type emptyStmt empty
+type emptyStmt struct{ span }
 
 type ifStmt struct {
+	span
 	init  astDecl // Variable declaration or expression.
 	cond  astExpr
 	then  astStmt
 	else_ astStmt
+	slots int // Scope size.
 }
 
 type forStmt struct {
-	init astDecl // Variable declaration or expression.
-	cond astExpr
-	post astExpr
-	loop astStmt
+	span
+	init  astDecl // Variable declaration or expression.
+	cond  astExpr
+	post  astExpr
+	loop  astStmt
+	slots int     // Scope size.
+	label varName // Empty if loop is not labeled.
 }
 
 type forEachStmt struct {
-	// TODO: implement
+	span
+	key   varName // Empty if only value is declared.
+	value varName
+	iter  astExpr
+	loop  astStmt
+	slots int     // Scope size of one iteration.
+	label varName // Empty if loop is not labeled.
 }
 
 type whileStmt struct {
-	cond astExpr
-	loop astStmt
+	span
+	cond  astExpr
+	loop  astStmt
+	label varName // Empty if loop is not labeled.
 }
 
 type doStmt struct {
-	loop astStmt
-	cond astExpr
+	span
+	loop  astStmt
+	cond  astExpr
+	label varName // Empty if loop is not labeled.
+}
+
+type switchStmt struct {
+	span
+	value astExpr
+	cases []switchCase
+	label varName // Empty if switch is not labeled.
+}
+
+type switchCase struct {
+	values []astExpr // Empty for default case.
+	body   *blockStmt
 }
 
-type continueStmt empty
+type continueStmt struct {
+	span
+	label varName // Empty for the innermost loop.
+}
 
-type breakStmt empty // TODO: Label jump.
+type breakStmt struct {
+	span
+	label varName // Empty for the innermost loop or switch.
+}
 
 type throwStmt struct {
+	span
 	throw astExpr
 }
 
 type tryStmt struct {
+	span
 	try     astStmt
 	catch   astStmt
 	as      varName
@@ -96,50 +152,86 @@ type tryStmt struct {
 }
 
 type returnStmt struct {
+	span
 	value astExpr
 }
 
 type exprStmt struct {
+	span
 	expr astExpr
 }
 
 /* == expression ============================================================ */
 
-type emptyExpr empty
+type emptyExpr struct{ span }
 
 type assignExpr struct {
-	left  astExpr
+	span
+	left  astExpr // Identifier or index.
+	op    token   // '=' or compound assignment operator.
 	right astExpr
 }
 
 type prefixExpr struct {
+	span
 	op    token
 	right astExpr
 }
 
 type infixExpr struct {
+	span
+	left  astExpr
+	op    token
+	right astExpr
+}
+
+// logicalExpr evaluates right operand only if left one does not decide
+// the result.
+type logicalExpr struct {
+	span
 	left  astExpr
 	op    token
 	right astExpr
 }
 
+type condExpr struct {
+	span
+	cond  astExpr
+	then  astExpr
+	else_ astExpr
+}
+
 type postfixExpr struct {
+	span
 	left astExpr
 	op   token
 }
 
 type callExpr struct {
-	left astExpr
-	args []astExpr
+	span
+	left     astExpr
+	args     []astExpr
+	optional bool           // Short-circuits the chain if callee is void.
+	this     *identifierLit // Receiver of `super` and lowered calls.
 }
 
 // Also used for dot properties.
 type indexExpr struct {
-	left  astExpr
-	index astExpr
+	span
+	left     astExpr
+	index    astExpr
+	optional bool // Short-circuits the chain if object is void.
+}
+
+// chainExpr is chain of index and call expressions with optional link,
+// it is void if any optional link short-circuits.
+type chainExpr struct {
+	span
+	expr astExpr
 }
 
 type protoTableExpr struct {
+	span
 	proto astExpr
 	table *tableLit
 }
@@ -147,35 +239,51 @@ type protoTableExpr struct {
 /* ==literals =============================================================== */
 
 type identifierLit struct {
+	span
 	varName
+	depth int // Resolved scope distance, -1 for globals.
+	slot  int
 }
 
-type nihilLit empty
+type nihilLit struct{ span }
 
 type booleanLit struct {
+	span
 	value bool
 }
 
 type integerLit struct {
+	span
 	value int64
 }
 
 type floatLit struct {
+	span
 	value float64
 }
 
 type stringLit struct {
+	span
 	value string
 }
 
 type tableLit struct {
-	pairs map[astExpr]astExpr
+	span
+	pairs []tablePair // In source order, later pair overwrites earlier.
 	array []astExpr
 }
 
+type tablePair struct {
+	key   astExpr // Nil for `...value`, which copies own pairs of the value.
+	value astExpr
+}
+
 type functionLit struct {
+	span
+	name   varName // Table key or class member, empty for anonymous.
 	params []varName
 	body   block
+	slots  int // Scope size, including params.
 }
 
 /* == marks ================================================================= */
@@ -192,6 +300,7 @@ func (n *forStmt) astStmtMark()      {}
 func (n *forEachStmt) astStmtMark()  {}
 func (n *whileStmt) astStmtMark()    {}
 func (n *doStmt) astStmtMark()       {}
+func (n *switchStmt) astStmtMark()   {}
 func (n *continueStmt) astStmtMark() {}
 func (n *breakStmt) astStmtMark()    {}
 func (n *throwStmt) astStmtMark()    {}
@@ -203,9 +312,12 @@ func (n *emptyExpr) astExprMark()      {}
 func (n *assignExpr) astExprMark()     {}
 func (n *prefixExpr) astExprMark()     {}
 func (n *infixExpr) astExprMark()      {}
+func (n *logicalExpr) astExprMark()    {}
+func (n *condExpr) astExprMark()       {}
 func (n *postfixExpr) astExprMark()    {}
 func (n *callExpr) astExprMark()       {}
 func (n *indexExpr) astExprMark()      {}
+func (n *chainExpr) astExprMark()      {}
 func (n *protoTableExpr) astExprMark() {}
 func (n *identifierLit) astExprMark()  {}
 func (n *nihilLit) astExprMark()       {}
@@ -230,6 +342,7 @@ func (n *forStmt) astNodeMark()      {}
 func (n *forEachStmt) astNodeMark()  {}
 func (n *whileStmt) astNodeMark()    {}
 func (n *doStmt) astNodeMark()       {}
+func (n *switchStmt) astNodeMark()   {}
 func (n *continueStmt) astNodeMark() {}
 func (n *breakStmt) astNodeMark()    {}
 func (n *throwStmt) astNodeMark()    {}
@@ -241,9 +354,12 @@ func (n *emptyExpr) astNodeMark()      {}
 func (n *assignExpr) astNodeMark()     {}
 func (n *prefixExpr) astNodeMark()     {}
 func (n *infixExpr) astNodeMark()      {}
+func (n *logicalExpr) astNodeMark()    {}
+func (n *condExpr) astNodeMark()       {}
 func (n *postfixExpr) astNodeMark()    {}
 func (n *callExpr) astNodeMark()       {}
 func (n *indexExpr) astNodeMark()      {}
+func (n *chainExpr) astNodeMark()      {}
 func (n *protoTableExpr) astNodeMark() {}
 func (n *identifierLit) astNodeMark()  {}
 func (n *nihilLit) astNodeMark()       {}
@@ -256,6 +372,63 @@ func (n *functionLit) astNodeMark()    {}
 
 /* == printer =============================================================== */
 
-type printer struct{}
-
-func (p *printer) print([]astDecl) {}
+// printer writes syntax tree as indented nodes with their fields.
+type printer struct {
+	sb    strings.Builder
+	depth int
+}
+
+func (p *printer) print(script []astDecl) string {
+	for _, decl := range script {
+		p.value("", reflect.ValueOf(decl))
+	}
+	return p.sb.String()
+}
+
+func (p *printer) line(format string, a ...any) {
+	fmt.Fprintf(&p.sb, "%*s", p.depth*2, "")
+	fmt.Fprintf(&p.sb, format, a...)
+	p.sb.WriteByte('\n')
+}
+
+// value prints the value prefixed by field name, node spans are skipped.
+func (p *printer) value(name string, v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			p.line("%snil", name)
+			return
+		}
+		p.value(name, v.Elem())
+	case reflect.Struct:
+		if v.Type() == reflect.TypeFor[token]() {
+			p.line("%s'%s'", name, v.FieldByName("literal").String())
+			return
+		}
+		p.line("%s%s", name, cmp.Or(v.Type().Name(), "struct"))
+		p.depth++
+		for i := range v.NumField() {
+			if field := v.Type().Field(i); field.Type != reflect.TypeFor[span]() {
+				p.value(field.Name+": ", v.Field(i))
+			}
+		}
+		p.depth--
+	case reflect.Slice:
+		p.line("%s[%d]", name, v.Len())
+		p.depth++
+		for i := range v.Len() {
+			p.value("", v.Index(i))
+		}
+		p.depth--
+	case reflect.Map:
+		p.line("%s{%d}", name, v.Len())
+		p.depth++
+		for iter := v.MapRange(); iter.Next(); {
+			p.value("key: ", iter.Key())
+			p.value("value: ", iter.Value())
+		}
+		p.depth--
+	default:
+		p.line("%s%v", name, v)
+	}
+}
@@ -0,0 +1,240 @@
+package eule
+
+import (
+	"fmt"
+	"strings"
+)
+
+type opCode uint8
+
+const (
+	opConstant opCode = iota // u16 constant
+	opNihil
+	opTrue
+	opFalse
+	opPop
+	opDup  // Pushes copy of the top value.
+	opDup2 // Pushes copies of two top values.
+	opBury // u8 depth, moves top value under depth values.
+
+	opDefineGlobal // u16 name
+	opGetGlobal    // u16 name
+	opSetGlobal    // u16 name
+	opDefineLocal  // u8 slot
+	opGetLocal     // u8 depth, u8 slot, u16 name
+	opSetLocal     // u8 depth, u8 slot, u16 name
+
+	opBeginScope // u8 size
+	opEndScope
+
+	opJump         // u16 offset
+	opJumpIfFalse  // u16 offset
+	opJumpIfTrue   // u16 offset
+	opJumpNotNihil // u16 offset
+	opJumpIfNihil  // u16 offset
+	opLoop         // u16 offset
+	opIterate      // Replaces iterated value with iterator.
+	opIterNext     // u16 offset to the loop end, pushes key and value.
+
+	opCall       // u8 args count
+	opCallMethod // u8 args count, receiver is under the callee.
+	opClosure    // u16 function
+	opReturn
+
+	opTable     // Pushes new empty table.
+	opInherit   // Sets prototype of the table, keeps table on stack.
+	opInitIndex // Stores pair in the table, keeps table on stack.
+	opSpread    // Copies pairs of the value to the table, keeps table.
+	opGetMethod // Replaces object and key with super and method, keeps receiver.
+	opGetIndex
+	opSetIndex
+
+	opNegate
+	opPositive
+	opNot
+	opBitNot
+	opIncrement
+	opDecrement
+
+	opAdd
+	opSubtract
+	opMultiply
+	opDivide
+	opModulo
+
+	opBitOr
+	opBitXor
+	opBitAnd
+	opShiftLeft
+	opShiftRight
+
+	opEqual
+	opNotEqual
+	opLess
+	opLessEqual
+	opGreater
+	opGreaterEqual
+
+	opThrow
+	opRethrow    // Raises pending error again after finally.
+	opTry        // u16 offset to handler
+	opTryFinally // u16 offset to handler, it gets pending error.
+	opEndTry     // Removes innermost handler.
+)
+
+var opNames = [...]string{
+	opConstant:     "CONSTANT",
+	opNihil:        "NIHIL",
+	opTrue:         "TRUE",
+	opFalse:        "FALSE",
+	opPop:          "POP",
+	opDup:          "DUP",
+	opDup2:         "DUP2",
+	opBury:         "BURY",
+	opDefineGlobal: "DEFINE_GLOBAL",
+	opGetGlobal:    "GET_GLOBAL",
+	opSetGlobal:    "SET_GLOBAL",
+	opDefineLocal:  "DEFINE_LOCAL",
+	opGetLocal:     "GET_LOCAL",
+	opSetLocal:     "SET_LOCAL",
+	opBeginScope:   "BEGIN_SCOPE",
+	opEndScope:     "END_SCOPE",
+	opJump:         "JUMP",
+	opJumpIfFalse:  "JUMP_IF_FALSE",
+	opJumpIfTrue:   "JUMP_IF_TRUE",
+	opJumpNotNihil: "JUMP_NOT_NIHIL",
+	opJumpIfNihil:  "JUMP_IF_NIHIL",
+	opLoop:         "LOOP",
+	opIterate:      "ITERATE",
+	opIterNext:     "ITER_NEXT",
+	opCall:         "CALL",
+	opCallMethod:   "CALL_METHOD",
+	opClosure:      "CLOSURE",
+	opReturn:       "RETURN",
+	opTable:        "TABLE",
+	opInherit:      "INHERIT",
+	opInitIndex:    "INIT_INDEX",
+	opSpread:       "SPREAD",
+	opGetMethod:    "GET_METHOD",
+	opGetIndex:     "GET_INDEX",
+	opSetIndex:     "SET_INDEX",
+	opNegate:       "NEGATE",
+	opPositive:     "POSITIVE",
+	opNot:          "NOT",
+	opBitNot:       "BIT_NOT",
+	opIncrement:    "INCREMENT",
+	opDecrement:    "DECREMENT",
+	opAdd:          "ADD",
+	opSubtract:     "SUBTRACT",
+	opMultiply:     "MULTIPLY",
+	opDivide:       "DIVIDE",
+	opModulo:       "MODULO",
+	opBitOr:        "BIT_OR",
+	opBitXor:       "BIT_XOR",
+	opBitAnd:       "BIT_AND",
+	opShiftLeft:    "SHIFT_LEFT",
+	opShiftRight:   "SHIFT_RIGHT",
+	opEqual:        "EQUAL",
+	opNotEqual:     "NOT_EQUAL",
+	opLess:         "LESS",
+	opLessEqual:    "LESS_EQUAL",
+	opGreater:      "GREATER",
+	opGreaterEqual: "GREATER_EQUAL",
+	opThrow:        "THROW",
+	opRethrow:      "RETHROW",
+	opTry:          "TRY",
+	opTryFinally:   "TRY_FINALLY",
+	opEndTry:       "END_TRY",
+}
+
+func (op opCode) String() string {
+	return opNames[op]
+}
+
+// chunk is compiled function body.
+type chunk struct {
+	name      string
+	code      []byte
+	spans     []span // Source span of every code byte.
+	constants []Value
+	functions []*chunk
+	params    []varName
+	slots     int // Function scope size, including params.
+}
+
+func newChunk(name string) *chunk {
+	return &chunk{
+		name:      name,
+		code:      make([]byte, 0),
+		spans:     make([]span, 0),
+		constants: make([]Value, 0),
+		functions: make([]*chunk, 0),
+	}
+}
+
+func (c *chunk) write(at span, bytes ...byte) {
+	c.code = append(c.code, bytes...)
+	for range bytes {
+		c.spans = append(c.spans, at)
+	}
+}
+
+func (c *chunk) readShort(offset int) int {
+	return int(c.code[offset])<<8 | int(c.code[offset+1])
+}
+
+/* == disassembler ========================================================== */
+
+func (c *chunk) disassemble() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "== %s ==\n", c.name)
+	for offset := 0; offset < len(c.code); {
+		offset = c.disassembleOp(&sb, offset)
+	}
+	for _, fn := range c.functions {
+		sb.WriteString(fn.disassemble())
+	}
+	return sb.String()
+}
+
+func (c *chunk) disassembleOp(sb *strings.Builder, offset int) int {
+	op := opCode(c.code[offset])
+	fmt.Fprintf(sb, "%04d %-16s", offset, op)
+
+	switch op {
+	case opConstant:
+		index := c.readShort(offset + 1)
+		fmt.Fprintf(sb, "%4d '%s'\n", index, c.constants[index])
+		return offset + 3
+	case opDefineGlobal, opGetGlobal, opSetGlobal:
+		index := c.readShort(offset + 1)
+		fmt.Fprintf(sb, "%4d '%s'\n", index, c.constants[index])
+		return offset + 3
+	case opDefineLocal, opBeginScope, opCall, opCallMethod, opBury:
+		fmt.Fprintf(sb, "%4d\n", c.code[offset+1])
+		return offset + 2
+	case opGetLocal, opSetLocal:
+		index := c.readShort(offset + 3)
+		fmt.Fprintf(
+			sb, "%4d %4d '%s'\n",
+			c.code[offset+1], c.code[offset+2], c.constants[index],
+		)
+		return offset + 5
+	case opJump, opJumpIfFalse, opJumpIfTrue, opJumpNotNihil, opJumpIfNihil,
+		opTry, opTryFinally, opIterNext:
+		jump := c.readShort(offset + 1)
+		fmt.Fprintf(sb, "%4d -> %d\n", offset, offset+3+jump)
+		return offset + 3
+	case opLoop:
+		jump := c.readShort(offset + 1)
+		fmt.Fprintf(sb, "%4d -> %d\n", offset, offset+3-jump)
+		return offset + 3
+	case opClosure:
+		index := c.readShort(offset + 1)
+		fmt.Fprintf(sb, "%4d <%s>\n", index, c.functions[index].name)
+		return offset + 3
+	default:
+		sb.WriteByte('\n')
+		return offset + 1
+	}
+}
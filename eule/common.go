@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math"
 	"strconv"
+	"strings"
 )
 
 /* == header ================================================================ */
@@ -18,29 +19,17 @@ const (
 	uint8Count  int = math.MaxUint8 + 1
 	uint16Count int = math.MaxUint16 + 1
 
-	unreachable string = "unreachable"
-)
+	callDepthMax int = 4096 // Deeper call is stack overflow.
 
-// Debug information.
-const (
-	debugPrintTokens = true
-	debugPrintAst    = true
-)
-
-// Interpreter modes.
-const (
-	// Automaticly inserts semicolons.
-	modeAutoSemicolons = false
-	// Allows class syntax.
-	modeObjectOriented = false
-	// Allows `function() => toReturn`` syntax.
-	modeArrowFunctions = false
+	unreachable string = "unreachable"
 )
 
 // Language constants.
 const (
-	stringThis  = "this"
-	stringSuper = "super"
+	stringThis   = "this"
+	stringSuper  = "super"
+	stringStatic = "static"
+	stringNew    = "new"
 
 	stringNihil    = "void"
 	stringVariable = "var"
@@ -52,12 +41,28 @@ const (
 type empty = struct{}
 type varName = string
 
-/* == lib =================================================================== */
+// Errors lists every error found by one pass over the script, one error
+// per line.
+type Errors[E error] []E
 
-func panicf(format string, a ...any) {
-	panic(fmt.Sprintf(format, a...))
+func (es Errors[E]) Error() string {
+	messages := make([]string, len(es))
+	for i, err := range es {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
 }
 
+func (es Errors[E]) Unwrap() []error {
+	errs := make([]error, len(es))
+	for i, err := range es {
+		errs[i] = err
+	}
+	return errs
+}
+
+/* == lib =================================================================== */
+
 func formatFloat(f Number) string {
 	return strconv.FormatFloat(float64(f), 'g', -1, 64)
 }
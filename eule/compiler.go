@@ -0,0 +1,904 @@
+package eule
+
+import (
+	"cmp"
+	"fmt"
+)
+
+// CompileError is limit of the bytecode exceeded by the script, its Pos
+// and End methods return location of the node being compiled.
+type CompileError struct {
+	span
+	Message string
+}
+
+func (ce CompileError) Error() string {
+	return fmt.Sprintf("%s: %s\n%s", ce.span, ce.Message, ce.excerpt())
+}
+
+type unwindType int
+
+const (
+	unwindScope   unwindType = iota // Leaves scope.
+	unwindTry                       // Removes exception handler.
+	unwindFinally                   // Runs finally block.
+	unwindLoop                      // Jump target for break and continue.
+	unwindSwitch                    // Jump target for break.
+	unwindValue                     // Pops value kept on the stack.
+)
+
+// unwind is compiler record of an active construct that has to be cleaned
+// up by a jump out of it.
+type unwind struct {
+	unwindType
+	finally astStmt
+	loop    *loopJumps // Jumps of the loop or switch.
+}
+
+type loopJumps struct {
+	label     varName
+	start     int   // Continue target, -1 if it is after the loop body.
+	continues []int // Forward jumps to continue target.
+	breaks    []int // Forward jumps to the loop end.
+}
+
+type compiler struct {
+	chunk      *chunk
+	constants  map[Value]int
+	unwinds    []unwind
+	span       span  // Span of the node being compiled.
+	chainJumps []int // Jumps of optional links to the chain end.
+}
+
+func newCompiler(name string) *compiler {
+	return &compiler{
+		chunk:     newChunk(name),
+		constants: make(map[Value]int),
+		unwinds:   make([]unwind, 0),
+	}
+}
+
+func (c *compiler) Compile(script []astDecl) (code *chunk, err error) {
+	defer catch(func(ce CompileError) {
+		code = nil
+		err = ce
+	})
+
+	// Value of the last expression statement is the script result.
+	result := astExpr(&nihilLit{})
+	if len(script) != 0 {
+		if decl, ok := script[len(script)-1].(*stmtDecl); ok {
+			if stmt, ok := decl.stmt.(*exprStmt); ok {
+				script = script[:len(script)-1]
+				result = stmt.expr
+			}
+		}
+	}
+
+	for _, decl := range script {
+		c.compile(decl)
+	}
+	c.compile(result)
+	c.emit(opReturn)
+
+	return c.chunk, nil
+}
+
+func (c *compiler) errorf(format string, a ...any) {
+	panic(CompileError{c.span, fmt.Sprintf(format, a...)})
+}
+
+/* == emit ================================================================== */
+
+func (c *compiler) emit(ops ...opCode) {
+	for _, op := range ops {
+		c.chunk.write(c.span, byte(op))
+	}
+}
+
+func (c *compiler) emitByte(op opCode, operand int) {
+	if operand > int(uint8Max) {
+		c.errorf("operand of %s is too large", op)
+	}
+	c.chunk.write(c.span, byte(op), byte(operand))
+}
+
+func (c *compiler) emitShort(op opCode, operand int) {
+	c.chunk.write(c.span, byte(op))
+	c.writeShort(operand)
+}
+
+func (c *compiler) writeShort(operand int) {
+	if operand > int(uint16Max) {
+		c.errorf("operand is too large")
+	}
+	c.chunk.write(c.span, byte(operand>>8), byte(operand))
+}
+
+func (c *compiler) makeConstant(value Value) int {
+	if index, ok := c.constants[value]; ok {
+		return index
+	}
+	if len(c.chunk.constants) == uint16Count {
+		c.errorf("too many constants in one function")
+	}
+	c.chunk.constants = append(c.chunk.constants, value)
+	c.constants[value] = len(c.chunk.constants) - 1
+	return len(c.chunk.constants) - 1
+}
+
+func (c *compiler) emitConstant(value Value) {
+	c.emitShort(opConstant, c.makeConstant(value))
+}
+
+// emitJump returns offset of the jump operand to patch.
+func (c *compiler) emitJump(op opCode) int {
+	c.emitShort(op, 0)
+	return len(c.chunk.code) - 2
+}
+
+func (c *compiler) patchJump(offset int) {
+	jump := len(c.chunk.code) - offset - 2
+	if jump > int(uint16Max) {
+		c.errorf("too much code to jump over")
+	}
+	c.chunk.code[offset] = byte(jump >> 8)
+	c.chunk.code[offset+1] = byte(jump)
+}
+
+func (c *compiler) emitLoop(start int) {
+	c.emit(opLoop)
+	jump := len(c.chunk.code) - start + 2
+	if jump > int(uint16Max) {
+		c.errorf("loop body is too large")
+	}
+	c.writeShort(jump)
+}
+
+/* == unwinds =============================================================== */
+
+func (c *compiler) pushUnwind(u unwind) {
+	c.unwinds = append(c.unwinds, u)
+}
+
+func (c *compiler) popUnwind() {
+	c.unwinds = c.unwinds[:len(c.unwinds)-1]
+}
+
+func (c *compiler) beginScope(size int) {
+	c.emitByte(opBeginScope, size)
+	c.pushUnwind(unwind{unwindType: unwindScope})
+}
+
+func (c *compiler) endScope() {
+	c.popUnwind()
+	c.emit(opEndScope)
+}
+
+// unwindTo emits cleanup of every construct above the given unwind index.
+// Index -1 unwinds for return, it keeps stack values to the frame drop.
+func (c *compiler) unwindTo(index int) {
+	saved := c.unwinds
+	defer func() { c.unwinds = saved }()
+
+	for i := len(saved) - 1; i > index; i-- {
+		c.unwinds = saved[:i:i] // Keeps saved unwinds from appends.
+		switch u := saved[i]; u.unwindType {
+		case unwindScope:
+			c.emit(opEndScope)
+		case unwindTry:
+			c.emit(opEndTry)
+		case unwindFinally:
+			if index < 0 {
+				// Values above are kept for return, jumps out of the
+				// finally block pop them.
+				for _, v := range saved[i+1:] {
+					if v.unwindType == unwindValue {
+						c.unwinds = append(c.unwinds, v)
+					}
+				}
+			}
+			c.compile(u.finally)
+		case unwindValue:
+			if index >= 0 {
+				c.emit(opPop)
+			}
+		}
+	}
+}
+
+// jumpTarget returns unwind index of the break or continue target, it is
+// the labeled statement or the innermost one.
+func (c *compiler) jumpTarget(isBreak bool, label varName) int {
+	for i := len(c.unwinds) - 1; i >= 0; i-- {
+		u := c.unwinds[i]
+		if u.unwindType != unwindLoop && u.unwindType != unwindSwitch {
+			continue
+		}
+		if label != "" {
+			if u.loop.label == label {
+				return i
+			}
+		} else if isBreak || u.unwindType == unwindLoop {
+			return i
+		}
+	}
+	panic(unreachable)
+}
+
+func (c *compiler) hasFinally() bool {
+	for _, u := range c.unwinds {
+		if u.unwindType == unwindFinally {
+			return true
+		}
+	}
+	return false
+}
+
+/* == compile =============================================================== */
+
+func (c *compiler) compile(node astNode) {
+	// Synthesized nodes have no span and keep span of the parent.
+	if at := node.nodeSpan(); at.file != nil {
+		saved := c.span
+		c.span = at
+		defer func() { c.span = saved }()
+	}
+
+	switch node := node.(type) {
+	/* == declarations ====================================================== */
+	case *errorDecl:
+		panic(unreachable)
+	case *variableDecl:
+		for _, decl := range node.vars {
+			c.compile(decl.init)
+			c.define(decl.name, decl.slot)
+		}
+	case *functionDecl:
+		c.functionLit(node.function, node.name)
+		c.define(node.name, node.slot)
+	case *stmtDecl:
+		c.compile(node.stmt)
+	/* == statements ======================================================== */
+	case *emptyStmt:
+	case *blockStmt:
+		c.beginScope(node.slots)
+		c.block(node.block)
+		c.endScope()
+	case *ifStmt:
+		c.ifStmt(node)
+	case *forStmt:
+		c.forStmt(node)
+	case *forEachStmt:
+		c.forEachStmt(node)
+	case *whileStmt:
+		c.whileStmt(node)
+	case *doStmt:
+		c.doStmt(node)
+	case *switchStmt:
+		c.switchStmt(node)
+	case *continueStmt:
+		index := c.jumpTarget(false, node.label)
+		c.unwindTo(index)
+		loop := c.unwinds[index].loop
+		if loop.start < 0 {
+			loop.continues = append(loop.continues, c.emitJump(opJump))
+		} else {
+			c.emitLoop(loop.start)
+		}
+	case *breakStmt:
+		index := c.jumpTarget(true, node.label)
+		c.unwindTo(index)
+		loop := c.unwinds[index].loop
+		loop.breaks = append(loop.breaks, c.emitJump(opJump))
+	case *throwStmt:
+		c.compile(node.throw)
+		c.emit(opThrow)
+	case *tryStmt:
+		c.tryStmt(node)
+	case *returnStmt:
+		c.compile(node.value)
+		if c.hasFinally() {
+			c.pushUnwind(unwind{unwindType: unwindValue}) // Return value.
+			c.unwindTo(-1)
+			c.popUnwind()
+		}
+		c.emit(opReturn)
+	case *exprStmt:
+		c.compile(node.expr)
+		c.emit(opPop)
+	/* == expressions ======================================================= */
+	case *emptyExpr:
+		c.emit(opNihil)
+	case *assignExpr:
+		c.assignExpr(node)
+	case *prefixExpr:
+		if op, ok := incrementOps[node.op.tokenType]; ok {
+			c.increment(node.right, op, false)
+			break
+		}
+		c.compile(node.right)
+		switch node.op.tokenType {
+		case tokenMinus:
+			c.emit(opNegate)
+		case tokenPlus:
+			c.emit(opPositive)
+		case tokenExcl:
+			c.emit(opNot)
+		case tokenTilde:
+			c.emit(opBitNot)
+		default:
+			c.errorf("unsupported prefix operator '%s'", node.op.literal)
+		}
+	case *infixExpr:
+		c.compile(node.left)
+		c.compile(node.right)
+		op, ok := infixOps[node.op.tokenType]
+		if !ok {
+			c.errorf("unsupported infix operator '%s'", node.op.literal)
+		}
+		c.emit(op)
+	case *logicalExpr:
+		c.compile(node.left)
+		jump, ok := logicalJumps[node.op.tokenType]
+		if !ok {
+			c.errorf("unsupported logical operator '%s'", node.op.literal)
+		}
+		endJump := c.emitJump(jump)
+		c.emit(opPop)
+		c.compile(node.right)
+		c.patchJump(endJump)
+	case *condExpr:
+		c.compile(node.cond)
+		elseJump := c.emitJump(opJumpIfFalse)
+		c.emit(opPop)
+		c.compile(node.then)
+		endJump := c.emitJump(opJump)
+		c.patchJump(elseJump)
+		c.emit(opPop)
+		c.compile(node.else_)
+		c.patchJump(endJump)
+	case *postfixExpr:
+		op, ok := incrementOps[node.op.tokenType]
+		if !ok {
+			c.errorf("unsupported postfix operator '%s'", node.op.literal)
+		}
+		c.increment(node.left, op, true)
+	case *callExpr:
+		op := c.callee(node)
+		for _, arg := range node.args {
+			c.compile(arg)
+		}
+		if len(node.args) > int(uint8Max) {
+			c.errorf("too many arguments")
+		}
+		c.emitByte(op, len(node.args))
+	case *indexExpr:
+		c.link(node.left, node.optional)
+		c.compile(node.index)
+		c.emit(opGetIndex)
+	case *chainExpr:
+		saved := c.chainJumps
+		c.chainJumps = make([]int, 0)
+		c.compile(node.expr)
+		c.patchJumps(c.chainJumps)
+		c.chainJumps = saved
+	case *protoTableExpr:
+		c.compile(node.proto)
+		c.compile(node.table)
+		c.emit(opInherit)
+
+	case *identifierLit:
+		if node.depth < 0 {
+			c.emitShort(opGetGlobal, c.makeConstant(String(node.varName)))
+		} else {
+			c.emitLocal(opGetLocal, node)
+		}
+	case *nihilLit:
+		c.emit(opNihil)
+	case *booleanLit:
+		if node.value {
+			c.emit(opTrue)
+		} else {
+			c.emit(opFalse)
+		}
+	case *integerLit:
+		c.emitConstant(Number(node.value))
+	case *floatLit:
+		c.emitConstant(Number(node.value))
+	case *stringLit:
+		c.emitConstant(String(node.value))
+	case *tableLit:
+		c.emit(opTable)
+		for _, pair := range node.pairs {
+			if pair.key == nil {
+				c.compile(pair.value)
+				saved := c.span
+				c.span = pair.value.nodeSpan()
+				c.emit(opSpread)
+				c.span = saved
+				continue
+			}
+			c.compile(pair.key)
+			c.compile(pair.value)
+			c.emit(opInitIndex)
+		}
+		for i, v := range node.array {
+			c.emitConstant(Number(i))
+			c.compile(v)
+			c.emit(opInitIndex)
+		}
+	case *functionLit:
+		c.functionLit(node, cmp.Or(node.name, stringFunction))
+
+	default:
+		panic(unreachable)
+	}
+}
+
+// link compiles left side of index or call, optional link jumps to the
+// chain end with void on the stack as the chain result.
+func (c *compiler) link(left astExpr, optional bool) {
+	c.compile(left)
+	if optional {
+		c.chainJumps = append(c.chainJumps, c.emitJump(opJumpIfNihil))
+	}
+}
+
+// callee compiles the called value and returns call instruction. Index
+// callee is compiled as method, its receiver is kept under it.
+func (c *compiler) callee(node *callExpr) opCode {
+	index, ok := node.left.(*indexExpr)
+	if !ok && node.this != nil { // Lowered call on `this`.
+		c.compile(node.this)
+		c.emit(opNihil)
+		c.compile(node.left)
+		return opCallMethod
+	}
+	if !ok {
+		c.link(node.left, node.optional)
+		return opCall
+	}
+
+	saved := c.span
+	c.span = index.span
+	c.link(index.left, index.optional)
+	if node.this != nil { // Super method is called on `this`.
+		c.compile(node.this)
+		c.emitByte(opBury, 1)
+	} else {
+		c.emit(opDup)
+	}
+	c.compile(index.index)
+	c.emit(opGetMethod)
+	c.span = saved
+
+	if node.optional {
+		skip := c.emitJump(opJumpNotNihil)
+		c.emit(opPop, opPop, opPop, opNihil)
+		c.chainJumps = append(c.chainJumps, c.emitJump(opJump))
+		c.patchJump(skip)
+	}
+	return opCallMethod
+}
+
+func (c *compiler) block(block block) {
+	for _, decl := range block {
+		c.compile(decl)
+	}
+}
+
+func (c *compiler) define(name varName, slot int) {
+	if slot < 0 {
+		c.emitShort(opDefineGlobal, c.makeConstant(String(name)))
+	} else {
+		c.emitByte(opDefineLocal, slot)
+	}
+}
+
+func (c *compiler) emitLocal(op opCode, node *identifierLit) {
+	if node.depth > int(uint8Max) {
+		c.errorf("too deep scope nesting")
+	}
+	if node.slot > int(uint8Max) {
+		c.errorf("too many variables in one scope")
+	}
+	c.chunk.write(c.span, byte(op), byte(node.depth), byte(node.slot))
+	c.writeShort(c.makeConstant(String(node.varName)))
+}
+
+func (c *compiler) ifStmt(node *ifStmt) {
+	c.beginScope(node.slots)
+	c.compile(node.init)
+	c.compile(node.cond)
+	elseJump := c.emitJump(opJumpIfFalse)
+	c.emit(opPop)
+	c.compile(node.then)
+	endJump := c.emitJump(opJump)
+	c.patchJump(elseJump)
+	c.emit(opPop)
+	c.compile(node.else_)
+	c.patchJump(endJump)
+	c.endScope()
+}
+
+func (c *compiler) beginLoop(start int, label varName) *loopJumps {
+	loop := &loopJumps{label: label, start: start}
+	c.pushUnwind(unwind{unwindType: unwindLoop, loop: loop})
+	return loop
+}
+
+func (c *compiler) patchJumps(jumps []int) {
+	for _, jump := range jumps {
+		c.patchJump(jump)
+	}
+}
+
+func (c *compiler) forStmt(node *forStmt) {
+	c.beginScope(node.slots)
+	c.compile(node.init)
+
+	start := len(c.chunk.code)
+	exitJump := -1
+	if _, ok := node.cond.(*emptyExpr); !ok {
+		c.compile(node.cond)
+		exitJump = c.emitJump(opJumpIfFalse)
+		c.emit(opPop)
+	}
+
+	loop := c.beginLoop(-1, node.label)
+	c.compile(node.loop)
+	c.popUnwind()
+
+	c.patchJumps(loop.continues)
+	if _, ok := node.post.(*emptyExpr); !ok {
+		c.compile(node.post)
+		c.emit(opPop)
+	}
+	c.emitLoop(start)
+
+	if exitJump >= 0 {
+		c.patchJump(exitJump)
+		c.emit(opPop)
+	}
+	c.patchJumps(loop.breaks)
+	c.endScope()
+}
+
+// forEachStmt keeps iterator on the stack while the loop runs, every
+// iteration has its own scope.
+func (c *compiler) forEachStmt(node *forEachStmt) {
+	c.compile(node.iter)
+	// Iteration errors are reported at the iterated expression.
+	saved := c.span
+	c.span = node.iter.nodeSpan()
+	c.emit(opIterate)
+	start := len(c.chunk.code)
+	exitJump := c.emitJump(opIterNext)
+	c.span = saved
+
+	c.pushUnwind(unwind{unwindType: unwindValue})
+	loop := c.beginLoop(start, node.label)
+	c.beginScope(node.slots)
+	if node.key != "" {
+		c.emitByte(opDefineLocal, 1)
+		c.emitByte(opDefineLocal, 0)
+	} else {
+		c.emitByte(opDefineLocal, 0)
+		c.emit(opPop)
+	}
+	c.compile(node.loop)
+	c.endScope()
+	c.popUnwind()
+	c.popUnwind()
+	c.emitLoop(start)
+
+	c.patchJump(exitJump)
+	c.patchJumps(loop.breaks)
+	c.emit(opPop)
+}
+
+func (c *compiler) whileStmt(node *whileStmt) {
+	start := len(c.chunk.code)
+	c.compile(node.cond)
+	exitJump := c.emitJump(opJumpIfFalse)
+	c.emit(opPop)
+
+	loop := c.beginLoop(start, node.label)
+	c.compile(node.loop)
+	c.popUnwind()
+	c.emitLoop(start)
+
+	c.patchJump(exitJump)
+	c.emit(opPop)
+	c.patchJumps(loop.breaks)
+}
+
+func (c *compiler) doStmt(node *doStmt) {
+	start := len(c.chunk.code)
+
+	loop := c.beginLoop(-1, node.label)
+	c.compile(node.loop)
+	c.popUnwind()
+
+	c.patchJumps(loop.continues)
+	c.compile(node.cond)
+	exitJump := c.emitJump(opJumpIfFalse)
+	c.emit(opPop)
+	c.emitLoop(start)
+
+	c.patchJump(exitJump)
+	c.emit(opPop)
+	c.patchJumps(loop.breaks)
+}
+
+// switchStmt keeps switch value on the stack while cases are tested and
+// the matched body runs.
+func (c *compiler) switchStmt(node *switchStmt) {
+	c.compile(node.value)
+	c.pushUnwind(unwind{unwindType: unwindValue})
+
+	bodyJumps := make([][]int, len(node.cases))
+	defaultCase := -1
+	for i, clause := range node.cases {
+		if len(clause.values) == 0 {
+			defaultCase = i
+			continue
+		}
+		for _, value := range clause.values {
+			c.emit(opDup)
+			c.compile(value)
+			saved := c.span
+			c.span = value.nodeSpan()
+			c.emit(opEqual)
+			c.span = saved
+			nextJump := c.emitJump(opJumpIfFalse)
+			c.emit(opPop)
+			bodyJumps[i] = append(bodyJumps[i], c.emitJump(opJump))
+			c.patchJump(nextJump)
+			c.emit(opPop)
+		}
+	}
+	defaultJump := c.emitJump(opJump)
+
+	jumps := &loopJumps{label: node.label, start: -1}
+	c.pushUnwind(unwind{unwindType: unwindSwitch, loop: jumps})
+	endJumps := make([]int, 0, len(node.cases))
+	for i, clause := range node.cases {
+		if i == defaultCase {
+			c.patchJump(defaultJump)
+		} else {
+			c.patchJumps(bodyJumps[i])
+		}
+		c.compile(clause.body)
+		endJumps = append(endJumps, c.emitJump(opJump))
+	}
+	c.popUnwind()
+
+	if defaultCase < 0 {
+		c.patchJump(defaultJump)
+	}
+	c.patchJumps(endJumps)
+	c.patchJumps(jumps.breaks)
+	c.popUnwind()
+	c.emit(opPop)
+}
+
+// tryStmt runs finally block on every way out of the statement: normal
+// completion, jumps and exceptions, which are rethrown after it.
+func (c *compiler) tryStmt(node *tryStmt) {
+	finally := unwind{unwindType: unwindFinally, finally: node.finally}
+	hasFinally := node.finally != nil
+
+	if hasFinally {
+		c.pushUnwind(finally)
+	}
+	tryOp := opTry
+	if node.catch == nil { // Handler runs finally and rethrows.
+		tryOp = opTryFinally
+	}
+	handlerJump := c.emitJump(tryOp)
+	c.pushUnwind(unwind{unwindType: unwindTry})
+	c.compile(node.try)
+	c.popUnwind()
+	c.emit(opEndTry)
+	if hasFinally {
+		c.popUnwind()
+		c.compile(node.finally)
+	}
+	endJumps := []int{c.emitJump(opJump)}
+
+	// Thrown value is on the stack.
+	c.patchJump(handlerJump)
+	if node.catch != nil {
+		if hasFinally {
+			c.pushUnwind(finally)
+		}
+		if node.as != "" {
+			c.beginScope(1)
+			c.emitByte(opDefineLocal, 0)
+		} else {
+			c.beginScope(0)
+			c.emit(opPop)
+		}
+		// Handler is installed without thrown value on the stack.
+		rethrowJump := -1
+		if hasFinally {
+			rethrowJump = c.emitJump(opTryFinally)
+			c.pushUnwind(unwind{unwindType: unwindTry})
+		}
+		c.compile(node.catch)
+		if hasFinally {
+			c.popUnwind()
+			c.emit(opEndTry)
+		}
+		c.endScope()
+
+		if hasFinally {
+			c.popUnwind()
+			c.compile(node.finally)
+			endJumps = append(endJumps, c.emitJump(opJump))
+
+			// Handler restores catch scope.
+			c.patchJump(rethrowJump)
+			c.emit(opEndScope)
+			c.rethrowAfter(node.finally)
+		}
+	} else {
+		c.rethrowAfter(node.finally)
+	}
+	c.patchJumps(endJumps)
+}
+
+// rethrowAfter runs finally block of the handler that keeps pending error on
+// the stack and raises the error again with its position and trace.
+func (c *compiler) rethrowAfter(finally astStmt) {
+	c.pushUnwind(unwind{unwindType: unwindValue})
+	c.compile(finally)
+	c.popUnwind()
+	c.emit(opRethrow)
+}
+
+// loadTarget pushes current value of the assignment target, index target
+// keeps its object and key on the stack for storeTarget.
+func (c *compiler) loadTarget(target astExpr) {
+	switch target := target.(type) {
+	case *identifierLit:
+		c.compile(target)
+	case *indexExpr:
+		c.compile(target.left)
+		c.compile(target.index)
+		c.emit(opDup2, opGetIndex)
+	default:
+		panic(unreachable)
+	}
+}
+
+// storeTarget stores value on top of the stack and leaves it there.
+func (c *compiler) storeTarget(target astExpr) {
+	switch target := target.(type) {
+	case *identifierLit:
+		if target.depth < 0 {
+			c.emitShort(opSetGlobal, c.makeConstant(String(target.varName)))
+		} else {
+			c.emitLocal(opSetLocal, target)
+		}
+	case *indexExpr:
+		c.emit(opSetIndex)
+	default:
+		panic(unreachable)
+	}
+}
+
+// targetSize returns count of values kept on the stack by loadTarget under
+// the target value.
+func targetSize(target astExpr) int {
+	if _, ok := target.(*indexExpr); ok {
+		return 2
+	}
+	return 0
+}
+
+func (c *compiler) assignExpr(node *assignExpr) {
+	if node.op.tokenType == tokenEq {
+		if left, ok := node.left.(*indexExpr); ok {
+			c.compile(left.left)
+			c.compile(left.index)
+		}
+		c.compile(node.right)
+		c.storeTarget(node.left)
+		return
+	}
+
+	op := compoundOps[node.op.tokenType]
+	c.loadTarget(node.left)
+	if jump, ok := logicalJumps[op]; ok {
+		shortJump := c.emitJump(jump)
+		c.emit(opPop)
+		c.compile(node.right)
+		c.storeTarget(node.left)
+		endJump := c.emitJump(opJump)
+
+		// Current value is the result, target is not stored.
+		c.patchJump(shortJump)
+		if size := targetSize(node.left); size != 0 {
+			c.emitByte(opBury, size)
+			for range size {
+				c.emit(opPop)
+			}
+		}
+		c.patchJump(endJump)
+		return
+	}
+
+	c.compile(node.right)
+	infix, ok := infixOps[op]
+	if !ok {
+		c.errorf("unsupported assignment operator '%s'", node.op.literal)
+	}
+	c.emit(infix)
+	c.storeTarget(node.left)
+}
+
+// increment compiles '++' and '--', postfix form keeps the value before
+// increment under the target and leaves it as the result.
+func (c *compiler) increment(target astExpr, op opCode, isPostfix bool) {
+	c.loadTarget(target)
+	if isPostfix {
+		c.emit(opDup)
+		c.emitByte(opBury, targetSize(target)+1)
+	}
+	c.emit(op)
+	c.storeTarget(target)
+	if isPostfix {
+		c.emit(opPop)
+	}
+}
+
+func (c *compiler) functionLit(node *functionLit, name string) {
+	fc := newCompiler(name)
+	fc.span = node.span
+	fc.chunk.params = node.params
+	fc.chunk.slots = node.slots
+	fc.block(node.body)
+	fc.emit(opNihil, opReturn)
+
+	if len(c.chunk.functions) == uint16Count {
+		c.errorf("too many functions in one function")
+	}
+	c.chunk.functions = append(c.chunk.functions, fc.chunk)
+	c.emitShort(opClosure, len(c.chunk.functions)-1)
+}
+
+var incrementOps = map[tokenType]opCode{
+	tokenPlusPlus:   opIncrement,
+	tokenMinusMinus: opDecrement,
+}
+
+// logicalJumps maps logical operator to jump over its right operand.
+var logicalJumps = map[tokenType]opCode{
+	tokenAmperAmper: opJumpIfFalse,
+	tokenPipePipe:   opJumpIfTrue,
+	tokenQuestQuest: opJumpNotNihil,
+}
+
+var infixOps = map[tokenType]opCode{
+	tokenPlus:    opAdd,
+	tokenMinus:   opSubtract,
+	tokenStar:    opMultiply,
+	tokenSlash:   opDivide,
+	tokenPercent: opModulo,
+
+	tokenPipe:        opBitOr,
+	tokenCircum:      opBitXor,
+	tokenAmper:       opBitAnd,
+	tokenLAngleAngle: opShiftLeft,
+	tokenRAngleAngle: opShiftRight,
+
+	tokenEqEq:     opEqual,
+	tokenExclEq:   opNotEqual,
+	tokenLAngle:   opLess,
+	tokenLAngleEq: opLessEqual,
+	tokenRAngle:   opGreater,
+	tokenRAngleEq: opGreaterEqual,
+}
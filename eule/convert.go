@@ -0,0 +1,621 @@
+package eule
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Struct field tag with the table key of the field, "-" skips the field.
+const convertTag = "eule"
+
+const convertDepthMax = 64 // Deeper values are most likely cyclic.
+
+var (
+	valueType       = reflect.TypeFor[Value]()
+	errorType       = reflect.TypeFor[error]()
+	interpreterType = reflect.TypeFor[*Interpreter]()
+)
+
+// convertError describes why the value at the path can not be converted,
+// path is empty for the converted value itself.
+func convertError(path string, format string, a ...any) error {
+	message := fmt.Sprintf(format, a...)
+	if path == "" {
+		return errors.New(message)
+	}
+	return fmt.Errorf("%s: %s", path, message)
+}
+
+/* == go to eule ============================================================ */
+
+// ToValue converts Go value to script value. Booleans, numbers and strings
+// become values of the same kind, slices, arrays, maps and structs become
+// tables, functions become natives. Nil pointers, slices, maps and
+// functions become void, values implementing Value are kept as is.
+//
+// Struct fields are stored by name or by `eule:"key"` tag, unexported
+// fields and fields tagged `eule:"-"` are skipped.
+//
+// Converted function may take *Interpreter as the first parameter and may
+// return one value, an error, or a value and an error. Its arguments are
+// converted with FromValue, missing arguments are zero values.
+func ToValue(x any) (Value, error) {
+	return toValue(reflect.ValueOf(x), "", 0)
+}
+
+func toValue(rv reflect.Value, path string, depth int) (Value, error) {
+	if !rv.IsValid() {
+		return Nihil{}, nil
+	}
+	if depth > convertDepthMax {
+		return nil, convertError(path, "value is nested too deep, it may be cyclic")
+	}
+
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.Slice, reflect.Map,
+		reflect.Func:
+		if rv.IsNil() {
+			return Nihil{}, nil
+		}
+	}
+	if rv.Type().Implements(valueType) {
+		return rv.Interface().(Value), nil
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		return Boolean(rv.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		return Number(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		return Number(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return Number(rv.Float()), nil
+	case reflect.String:
+		return String(rv.String()), nil
+	case reflect.Pointer, reflect.Interface:
+		return toValue(rv.Elem(), path, depth+1)
+	case reflect.Slice, reflect.Array:
+		tbl := NewTable(nil)
+		for i := range rv.Len() {
+			value, err := toValue(
+				rv.Index(i),
+				fmt.Sprintf("%s[%d]", path, i),
+				depth+1,
+			)
+			if err != nil {
+				return nil, err
+			}
+			tbl.store(String(Number(i).String()), value)
+		}
+		return tbl, nil
+	case reflect.Map:
+		tbl := NewTable(nil)
+		for iter := rv.MapRange(); iter.Next(); {
+			keyPath := fmt.Sprintf("%s[%v]", path, iter.Key())
+			key, err := toValue(iter.Key(), keyPath, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			index, err := tableKey(key)
+			if err != nil {
+				return nil, convertError(
+					keyPath,
+					"map key must be string, number or boolean, got %s",
+					iter.Key().Type(),
+				)
+			}
+			value, err := toValue(iter.Value(), keyPath, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			tbl.store(index, value)
+		}
+		return tbl, nil
+	case reflect.Struct:
+		tbl := NewTable(nil)
+		for _, field := range structFields(rv.Type()) {
+			value, err := toValue(
+				rv.Field(field.index),
+				path+"."+field.name,
+				depth+1,
+			)
+			if err != nil {
+				return nil, err
+			}
+			tbl.store(String(field.key), value)
+		}
+		return tbl, nil
+	case reflect.Func:
+		return funcToNative(rv, path)
+	case reflect.Complex64, reflect.Complex128:
+		return nil, convertError(
+			path,
+			"%s is not supported, script has no complex numbers",
+			rv.Type(),
+		)
+	case reflect.Chan:
+		return nil, convertError(
+			path,
+			"%s is not supported, channels have no script value",
+			rv.Type(),
+		)
+	default:
+		return nil, convertError(path, "%s is not supported", rv.Type())
+	}
+}
+
+type structField struct {
+	index int
+	name  string // Go field name.
+	key   string // Table key.
+}
+
+func structFields(t reflect.Type) []structField {
+	fields := make([]structField, 0, t.NumField())
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		key := field.Name
+		if tag, ok := field.Tag.Lookup(convertTag); ok {
+			if tag == "-" {
+				continue
+			}
+			if tag != "" {
+				key = tag
+			}
+		}
+		fields = append(fields, structField{i, field.Name, key})
+	}
+	return fields
+}
+
+// checkResults returns error if function type has results other than
+// a value, an error, or both.
+func checkResults(t reflect.Type, path string) error {
+	if t.NumOut() > 2 || t.NumOut() == 2 && t.Out(1) != errorType {
+		return convertError(
+			path,
+			"%s is not supported, function must return a value, an error, or both",
+			t,
+		)
+	}
+	return nil
+}
+
+// returnsError reports whether the last result of function type is error.
+func returnsError(t reflect.Type) bool {
+	return t.NumOut() != 0 && t.Out(t.NumOut()-1) == errorType
+}
+
+func funcToNative(fn reflect.Value, path string) (*Native, error) {
+	t := fn.Type()
+	if err := checkResults(t, path); err != nil {
+		return nil, err
+	}
+
+	name := "native"
+	if info := runtime.FuncForPC(fn.Pointer()); info != nil {
+		name = info.Name()[strings.LastIndex(info.Name(), "/")+1:]
+	}
+
+	return NewNative(name, func(it *Interpreter, args []Value) (Value, error) {
+		return callFunc(it, fn, args)
+	}), nil
+}
+
+// callFunc converts args to parameters of Go function and calls it.
+func callFunc(it *Interpreter, fn reflect.Value, args []Value) (Value, error) {
+	t := fn.Type()
+	in := make([]reflect.Value, 0, t.NumIn())
+
+	first := 0
+	if t.NumIn() != 0 && t.In(0) == interpreterType {
+		in = append(in, reflect.ValueOf(it))
+		first = 1
+	}
+	fixed := t.NumIn() - first
+	if t.IsVariadic() {
+		fixed--
+	}
+	if !t.IsVariadic() && len(args) > fixed {
+		return nil, fmt.Errorf(
+			"too many arguments, expect %d, got %d",
+			fixed, len(args),
+		)
+	}
+
+	for i := range len(args) {
+		var param reflect.Type
+		if i < fixed {
+			param = t.In(first + i)
+		} else {
+			param = t.In(t.NumIn() - 1).Elem()
+		}
+		arg := reflect.New(param).Elem()
+		path := fmt.Sprintf("argument %d", i+1)
+		if err := fromValue(it, args[i], arg, path, 0); err != nil {
+			return nil, err
+		}
+		in = append(in, arg)
+	}
+	for i := len(args); i < fixed; i++ {
+		in = append(in, reflect.Zero(t.In(first+i)))
+	}
+
+	out := fn.Call(in)
+	if returnsError(t) {
+		if err := out[len(out)-1]; !err.IsNil() {
+			return nil, err.Interface().(error)
+		}
+		out = out[:len(out)-1]
+	}
+	if len(out) == 0 {
+		return Nihil{}, nil
+	}
+	return toValue(out[0], "result", 0)
+}
+
+/* == eule to go ============================================================ */
+
+// FromValue stores script value in the Go value target points to, it is
+// reverse of ToValue. Void stores zero value, void table pairs keep struct
+// fields unchanged, so target can hold defaults. Numbers stored in integers
+// and float32 must fit the type, integers must be whole. Targets of
+// interface type get bool, float64, string, []any for tables with only
+// array keys, map[string]any for other tables, functions are stored as
+// script values.
+//
+// Functions are converted to Go functions only by Interpreter.FromValue,
+// they need interpreter to run.
+func FromValue(v Value, target any) error {
+	return fromValueTarget(nil, v, target)
+}
+
+// FromValue is like package FromValue, it also converts script functions
+// and natives to Go functions that call them with the interpreter. Their
+// arguments are converted with ToValue and the result with FromValue,
+// function type may return one value, an error, or a value and an error.
+// Thrown values and conversion errors are returned as the error result,
+// functions without it panic with the error.
+func (it *Interpreter) FromValue(v Value, target any) error {
+	return fromValueTarget(it, v, target)
+}
+
+func fromValueTarget(it *Interpreter, v Value, target any) error {
+	rv := reflect.ValueOf(target)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("target must be non-nil pointer, got %T", target)
+	}
+	return fromValue(it, v, rv.Elem(), "", 0)
+}
+
+func fromValue(
+	it *Interpreter,
+	v Value,
+	dst reflect.Value,
+	path string,
+	depth int,
+) error {
+	if depth > convertDepthMax {
+		return convertError(path, "value is nested too deep, it may be cyclic")
+	}
+
+	t := dst.Type()
+	// Empty interface takes natural Go type of the value.
+	isAny := t.Kind() == reflect.Interface && t.NumMethod() == 0
+	if v != nil && !isAny && reflect.TypeOf(v).AssignableTo(t) {
+		dst.Set(reflect.ValueOf(v))
+		return nil
+	}
+	if _, ok := v.(Nihil); ok || v == nil {
+		dst.SetZero()
+		return nil
+	}
+
+	mismatch := func() error {
+		return convertError(path, "cannot convert %s to %s", v.typeOf(), t)
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		b, ok := v.(Boolean)
+		if !ok {
+			return mismatch()
+		}
+		dst.SetBool(bool(b))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		n, ok := v.(Number)
+		if !ok {
+			return mismatch()
+		}
+		if !isWhole(n) {
+			return convertError(path, "number %s is not an integer", n)
+		}
+		// Range is checked before the conversion, which is undefined for
+		// out of range floats.
+		limit := math.Ldexp(1, t.Bits()-1)
+		if float64(n) < -limit || float64(n) >= limit {
+			return convertError(path, "number %s overflows %s", n, t)
+		}
+		dst.SetInt(int64(n))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		n, ok := v.(Number)
+		if !ok {
+			return mismatch()
+		}
+		if !isWhole(n) {
+			return convertError(path, "number %s is not an integer", n)
+		}
+		if n < 0 || float64(n) >= math.Ldexp(1, t.Bits()) {
+			return convertError(path, "number %s overflows %s", n, t)
+		}
+		dst.SetUint(uint64(n))
+	case reflect.Float32, reflect.Float64:
+		n, ok := v.(Number)
+		if !ok {
+			return mismatch()
+		}
+		f := float64(n)
+		if t.Kind() == reflect.Float32 && !math.IsInf(f, 0) &&
+			math.Abs(f) > math.MaxFloat32 {
+			return convertError(path, "number %s overflows %s", n, t)
+		}
+		dst.SetFloat(f)
+	case reflect.String:
+		s, ok := v.(String)
+		if !ok {
+			return mismatch()
+		}
+		dst.SetString(string(s))
+	case reflect.Interface:
+		return fromValueToInterface(it, v, dst, path, depth)
+	case reflect.Pointer:
+		ptr := reflect.New(t.Elem())
+		if err := fromValue(it, v, ptr.Elem(), path, depth+1); err != nil {
+			return err
+		}
+		dst.Set(ptr)
+	case reflect.Slice, reflect.Array:
+		tbl, ok := v.(*Table)
+		if !ok {
+			return mismatch()
+		}
+		n := arrayLen(tbl)
+		if t.Kind() == reflect.Slice {
+			dst.Set(reflect.MakeSlice(t, n, n))
+		} else if n > t.Len() {
+			return convertError(
+				path,
+				"table has %d elements, %s holds %d",
+				n, t, t.Len(),
+			)
+		}
+		for i := range n {
+			err := fromValue(
+				it,
+				tbl.Pairs[String(Number(i).String())],
+				dst.Index(i),
+				fmt.Sprintf("%s[%d]", path, i),
+				depth+1,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		tbl, ok := v.(*Table)
+		if !ok {
+			return mismatch()
+		}
+		m := reflect.MakeMapWithSize(t, len(tbl.Pairs))
+		for k, pair := range tbl.Pairs {
+			keyPath := fmt.Sprintf("%s[%q]", path, k)
+			key := reflect.New(t.Key()).Elem()
+			if err := parseMapKey(string(k), key, keyPath); err != nil {
+				return err
+			}
+			value := reflect.New(t.Elem()).Elem()
+			if err := fromValue(it, pair, value, keyPath, depth+1); err != nil {
+				return err
+			}
+			m.SetMapIndex(key, value)
+		}
+		dst.Set(m)
+	case reflect.Struct:
+		tbl, ok := v.(*Table)
+		if !ok {
+			return mismatch()
+		}
+		for _, field := range structFields(t) {
+			pair := tbl.load(String(field.key))
+			if _, ok := pair.(Nihil); ok {
+				continue
+			}
+			err := fromValue(
+				it,
+				pair,
+				dst.Field(field.index),
+				path+"."+field.name,
+				depth+1,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	case reflect.Func:
+		switch v.(type) {
+		case *Closure, *Native:
+		default:
+			return mismatch()
+		}
+		if it == nil {
+			return convertError(
+				path,
+				"cannot convert %s to %s, use Interpreter.FromValue to call it",
+				v.typeOf(), t,
+			)
+		}
+		if err := checkResults(t, path); err != nil {
+			return err
+		}
+		dst.Set(reflect.MakeFunc(t, func(in []reflect.Value) []reflect.Value {
+			return callValue(it, v, t, in)
+		}))
+	default:
+		return convertError(path, "%s is not supported", t)
+	}
+
+	return nil
+}
+
+// callValue calls script function with converted arguments of Go function
+// of type t and returns its results.
+func callValue(
+	it *Interpreter,
+	fn Value,
+	t reflect.Type,
+	in []reflect.Value,
+) []reflect.Value {
+	out := make([]reflect.Value, t.NumOut())
+	for i := range out {
+		out[i] = reflect.New(t.Out(i)).Elem()
+	}
+	fail := func(err error) []reflect.Value {
+		if !returnsError(t) {
+			panic(err)
+		}
+		out[len(out)-1].Set(reflect.ValueOf(err))
+		return out
+	}
+
+	if t.IsVariadic() {
+		rest := in[len(in)-1]
+		in = in[: len(in)-1 : len(in)-1]
+		for i := range rest.Len() {
+			in = append(in, rest.Index(i))
+		}
+	}
+	args := make([]Value, len(in))
+	for i, arg := range in {
+		value, err := toValue(arg, fmt.Sprintf("argument %d", i+1), 0)
+		if err != nil {
+			return fail(err)
+		}
+		args[i] = value
+	}
+
+	result, err := it.Call(fn, args...)
+	if err != nil {
+		return fail(err)
+	}
+	if len(out) == 0 || len(out) == 1 && returnsError(t) {
+		return out
+	}
+	if err := fromValue(it, result, out[0], "result", 0); err != nil {
+		return fail(err)
+	}
+	return out
+}
+
+// fromValueToInterface stores value of the natural Go type for the value.
+func fromValueToInterface(
+	it *Interpreter,
+	v Value,
+	dst reflect.Value,
+	path string,
+	depth int,
+) error {
+	var natural reflect.Type
+	switch v := v.(type) {
+	case Boolean:
+		natural = reflect.TypeFor[bool]()
+	case Number:
+		natural = reflect.TypeFor[float64]()
+	case String:
+		natural = reflect.TypeFor[string]()
+	case *Table:
+		if len(v.Pairs) != 0 && arrayLen(v) == len(v.Pairs) {
+			natural = reflect.TypeFor[[]any]()
+		} else {
+			natural = reflect.TypeFor[map[string]any]()
+		}
+	default:
+		natural = reflect.TypeOf(v)
+	}
+
+	if !natural.AssignableTo(dst.Type()) {
+		return convertError(path, "cannot convert %s to %s", v.typeOf(), dst.Type())
+	}
+	value := reflect.New(natural).Elem()
+	if natural == reflect.TypeOf(v) {
+		value.Set(reflect.ValueOf(v))
+	} else if err := fromValue(it, v, value, path, depth+1); err != nil {
+		return err
+	}
+	dst.Set(value)
+	return nil
+}
+
+func parseMapKey(key string, dst reflect.Value, path string) error {
+	var err error
+	switch dst.Kind() {
+	case reflect.String:
+		dst.SetString(key)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		var n int64
+		n, err = strconv.ParseInt(key, 10, dst.Type().Bits())
+		dst.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		var n uint64
+		n, err = strconv.ParseUint(key, 10, dst.Type().Bits())
+		dst.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		var n float64
+		n, err = strconv.ParseFloat(key, dst.Type().Bits())
+		dst.SetFloat(n)
+	case reflect.Bool:
+		var b bool
+		b, err = strconv.ParseBool(key)
+		dst.SetBool(b)
+	default:
+		return convertError(
+			path,
+			"map key must be string, number or boolean, got %s",
+			dst.Type(),
+		)
+	}
+	if err != nil {
+		return convertError(path, "cannot convert key to %s", dst.Type())
+	}
+	return nil
+}
+
+// arrayLen returns count of consecutive array keys from 0.
+func arrayLen(tbl *Table) int {
+	n := 0
+	for {
+		if _, ok := tbl.Pairs[String(Number(n).String())]; !ok {
+			return n
+		}
+		n++
+	}
+}
+
+func isWhole(n Number) bool {
+	f := float64(n)
+	return !math.IsInf(f, 0) && f == math.Trunc(f)
+}
@@ -0,0 +1,373 @@
+package eule
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type point struct {
+	X, Y   int
+	Label  string `eule:"label"`
+	Hidden string `eule:"-"`
+	secret int
+}
+
+type shape struct {
+	Name   string
+	Points []point
+	Attrs  map[string]float64
+	Parent *shape
+}
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  any
+		target any // Pointer to zero value of the converted type.
+	}{
+		{"bool", true, new(bool)},
+		{"int", -42, new(int)},
+		{"uint8", uint8(255), new(uint8)},
+		{"float", 1.5, new(float64)},
+		{"string", "eule", new(string)},
+		{"slice", []int{1, 2, 3}, new([]int)},
+		{"array", [2]string{"a", "b"}, new([2]string)},
+		{"map", map[string]int{"a": 1, "b": 2}, new(map[string]int)},
+		{"int map", map[int]bool{1: true, 20: false}, new(map[int]bool)},
+		{"struct", point{X: 1, Y: 2, Label: "p"}, new(point)},
+		{"nested", shape{
+			Name:   "line",
+			Points: []point{{X: 1}, {Y: 2}},
+			Attrs:  map[string]float64{"width": 0.5},
+			Parent: &shape{Name: "group"},
+		}, new(shape)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v, err := ToValue(test.value)
+			if err != nil {
+				t.Fatalf("ToValue: %v", err)
+			}
+			if err := FromValue(v, test.target); err != nil {
+				t.Fatalf("FromValue: %v", err)
+			}
+			got := reflect.ValueOf(test.target).Elem().Interface()
+			if !reflect.DeepEqual(got, test.value) {
+				t.Errorf("got %#v, want %#v", got, test.value)
+			}
+		})
+	}
+}
+
+func TestToValueStruct(t *testing.T) {
+	v, err := ToValue(point{X: 1, Label: "p", Hidden: "h", secret: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tbl := v.(*Table)
+	for key, want := range map[String]Value{
+		"X":      Number(1),
+		"label":  String("p"),
+		"Label":  Nihil{},
+		"Hidden": Nihil{},
+		"secret": Nihil{},
+	} {
+		if got := tbl.load(key); got != want {
+			t.Errorf("%s: got %v, want %v", key, got, want)
+		}
+	}
+}
+
+func TestToValueNil(t *testing.T) {
+	for _, x := range []any{nil, (*point)(nil), []int(nil), map[string]int(nil)} {
+		v, err := ToValue(x)
+		if err != nil || v != (Nihil{}) {
+			t.Errorf("ToValue(%#v) = %v, %v, want void", x, v, err)
+		}
+	}
+}
+
+func TestToValueErrors(t *testing.T) {
+	cyclic := &shape{}
+	cyclic.Parent = cyclic
+	tests := []struct {
+		name  string
+		value any
+		err   string
+	}{
+		{"complex", complex(1, 2), "complex128 is not supported"},
+		{"chan", make(chan int), "channels have no script value"},
+		{"nested complex", []any{1, complex(1, 2)}, "[1]: complex128"},
+		{"map key", map[[2]int]int{{1, 2}: 3}, "map key must be string"},
+		{"cyclic", cyclic, "nested too deep"},
+		{"func results", func() (int, int) { return 0, 0 }, "must return a value"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ToValue(test.value)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got error %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestFromValueInterface(t *testing.T) {
+	var v Value
+	if err := FromValue(NewNumber(3), &v); err != nil || v != Number(3) {
+		t.Errorf("Value target: got %v, %v", v, err)
+	}
+	if err := FromValue(NewNihil(), &v); err != nil || v != (Nihil{}) {
+		t.Errorf("Value target of void: got %v, %v", v, err)
+	}
+
+	tbl := NewTable(nil)
+	var table *Table
+	if err := FromValue(tbl, &table); err != nil || table != tbl {
+		t.Errorf("*Table target: got %v, %v", table, err)
+	}
+
+	var x any
+	if err := FromValue(NewArray(Number(1), String("a")), &x); err != nil {
+		t.Fatal(err)
+	}
+	if want := []any{1.0, "a"}; !reflect.DeepEqual(x, want) {
+		t.Errorf("array to any: got %#v, want %#v", x, want)
+	}
+	tbl.store("k", Boolean(true))
+	if err := FromValue(tbl, &x); err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]any{"k": true}; !reflect.DeepEqual(x, want) {
+		t.Errorf("table to any: got %#v, want %#v", x, want)
+	}
+}
+
+func TestFromValueDefaults(t *testing.T) {
+	tbl := NewTable(nil)
+	tbl.store("X", Number(5))
+	p := point{X: 1, Y: 2, Label: "default"}
+	if err := FromValue(tbl, &p); err != nil {
+		t.Fatal(err)
+	}
+	if want := (point{X: 5, Y: 2, Label: "default"}); p != want {
+		t.Errorf("got %+v, want %+v", p, want)
+	}
+}
+
+func TestFromValueNumbers(t *testing.T) {
+	tests := []struct {
+		name   string
+		value  float64
+		target any
+		err    string // Empty if conversion succeeds.
+	}{
+		{"int64 min", math.MinInt64, new(int64), ""},
+		{"int64 above max", 1e19, new(int64), "overflows int64"},
+		{"int64 below min", -1e19, new(int64), "overflows int64"},
+		{"int64 max float", 1 << 63, new(int64), "overflows int64"},
+		{"int8 max", 127, new(int8), ""},
+		{"int8 above max", 128, new(int8), "overflows int8"},
+		{"int8 below min", -129, new(int8), "overflows int8"},
+		{"uint64 above max", 1e20, new(uint64), "overflows uint64"},
+		{"uint64 max float", 1 << 64, new(uint64), "overflows uint64"},
+		{"uint8 max", 255, new(uint8), ""},
+		{"uint8 above max", 256, new(uint8), "overflows uint8"},
+		{"uint negative", -1, new(uint), "overflows uint"},
+		{"float32 max", math.MaxFloat32, new(float32), ""},
+		{"float32 above max", 1e39, new(float32), "overflows float32"},
+		{"float32 below min", -1e39, new(float32), "overflows float32"},
+		{"fraction", 1.5, new(int), "not an integer"},
+		{"infinity", math.Inf(1), new(int), "not an integer"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := FromValue(NewNumber(test.value), test.target)
+			if test.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := reflect.ValueOf(test.target).Elem()
+				if got.Convert(reflect.TypeFor[float64]()).Float() != test.value {
+					t.Errorf("got %v, want %v", got, test.value)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got error %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestFromValueErrors(t *testing.T) {
+	cyclic := NewTable(nil)
+	cyclic.store("Self", cyclic)
+	keyed := NewTable(nil)
+	keyed.store("a", Number(1))
+	type node struct{ Self *node }
+	tests := []struct {
+		name   string
+		value  Value
+		target any
+		err    string
+	}{
+		{"mismatch", String("a"), new(int), "cannot convert string to int"},
+		{"path", NewArray(Number(1), String("a")), new([]int), "[1]: cannot convert"},
+		{"array length", NewArray(Number(1), Number(2)), new([1]int), "table has 2 elements"},
+		{"map key", keyed, new(map[int]int), "[\"a\"]"},
+		{"function", NewNative("f", nil), new(func()), "use Interpreter.FromValue"},
+		{"not function", Number(1), new(func()), "cannot convert number to func()"},
+		{"interface", Number(1), new(error), "cannot convert number to error"},
+		{"cyclic", cyclic, new(node), "nested too deep"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := FromValue(test.value, test.target)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("got error %v, want %q", err, test.err)
+			}
+		})
+	}
+
+	if err := FromValue(Number(1), 0); err == nil {
+		t.Error("non-pointer target is accepted")
+	}
+}
+
+func TestFuncToNative(t *testing.T) {
+	errFailed := errors.New("failed")
+	funcs := map[string]any{
+		"sum": func(first int, rest ...int) int {
+			for _, n := range rest {
+				first += n
+			}
+			return first
+		},
+		"div": func(a, b float64) (float64, error) {
+			if b == 0 {
+				return 0, errFailed
+			}
+			return a / b, nil
+		},
+		"value": func(v Value) string { return string(v.typeOf()) },
+		"self":  func(it *Interpreter, n int) bool { return it != nil && n == 1 },
+		"pair":  func(p point) int { return p.X + p.Y },
+	}
+	tests := []struct {
+		script string
+		want   any
+		err    string
+	}{
+		{"sum(1)", 1.0, ""},
+		{"sum(1, 2, 3)", 6.0, ""},
+		{"div(6, 3)", 2.0, ""},
+		{"div(1, 0)", nil, "failed"},
+		{"value(3)", "number", ""},
+		{"value({})", "table", ""},
+		{"pair({X: 1, Y: 2})", 3.0, ""},
+		{"self(1)", true, ""},
+		{"pair({X: 1.5})", nil, "argument 1.X: number 1.5 is not an integer"},
+		{"div(1, 2, 3)", nil, "too many arguments, expect 2, got 3"},
+		{"div(\"a\", 1)", nil, "argument 1: cannot convert string to float64"},
+	}
+	forBackends(t, func(t *testing.T, it *Interpreter) {
+		for name, fn := range funcs {
+			v, err := ToValue(fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			it.SetGlobal(name, v)
+		}
+		for _, test := range tests {
+			v, err := it.Interpret([]byte(test.script + ";"))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("%s: got error %v, want %q", test.script, err, test.err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Errorf("%s: %v", test.script, err)
+				continue
+			}
+			var got any
+			if err := FromValue(v, &got); err != nil || got != test.want {
+				t.Errorf("%s: got %v, %v, want %v", test.script, got, err, test.want)
+			}
+		}
+	})
+}
+
+func TestFromValueFunc(t *testing.T) {
+	forBackends(t, func(t *testing.T, it *Interpreter) {
+		v, err := it.Interpret([]byte(`
+			var add = function(a, b) { return a + b; };
+			var fail = function() { throw "failed"; };
+			var text = function() { return "a"; };
+			add;
+		`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var add func(a, b int) int
+		if err := it.FromValue(v, &add); err != nil {
+			t.Fatal(err)
+		}
+		if got := add(1, 2); got != 3 {
+			t.Errorf("add: got %v", got)
+		}
+		var sum func(n ...float64) float64
+		if err := it.FromValue(v, &sum); err != nil || sum(1.5, 2) != 3.5 {
+			t.Errorf("variadic add: got %v", err)
+		}
+
+		upper, err := ToValue(strings.ToUpper)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var toUpper func(string) string
+		if err := it.FromValue(upper, &toUpper); err != nil || toUpper("a") != "A" {
+			t.Errorf("native round trip: got %v", err)
+		}
+
+		fail, _ := it.GetGlobal("fail")
+		var failErr func() error
+		if err := it.FromValue(fail, &failErr); err != nil {
+			t.Fatal(err)
+		}
+		var re *RuntimeError
+		if err := failErr(); !errors.As(err, &re) || re.Value != String("failed") {
+			t.Errorf("thrown value: got %v", err)
+		}
+		var failPanic func()
+		if err := it.FromValue(fail, &failPanic); err != nil {
+			t.Fatal(err)
+		}
+		func() {
+			defer func() {
+				if p := recover(); p == nil {
+					t.Error("function without error result does not panic")
+				}
+			}()
+			failPanic()
+		}()
+
+		text, _ := it.GetGlobal("text")
+		var number func() (int, error)
+		if err := it.FromValue(text, &number); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := number(); err == nil || !strings.Contains(err.Error(), "result") {
+			t.Errorf("result conversion: got %v", err)
+		}
+
+		var results func() (int, int)
+		if err := it.FromValue(v, &results); err == nil {
+			t.Error("function with two values is accepted")
+		}
+	})
+}
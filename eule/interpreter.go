@@ -1,70 +1,392 @@
 package eule
 
 import (
-	"log"
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
 	"math"
+	"runtime/debug"
+	"strings"
 )
 
 type env struct {
-	encl *env
-	vars map[string]Value
+	encl  *env
+	slots []Value // Nil slot is not initialized yet.
 }
 
-func (e *env) define(name string, value Value) {
-	e.vars[name] = value
+func newEnv(encl *env, size int) *env {
+	return &env{encl: encl, slots: make([]Value, size)}
 }
 
-func (e *env) store(name string, value Value) {
-	e.vars[name] = value
+func (e *env) ancestor(depth int) *env {
+	for range depth {
+		e = e.encl
+	}
+	return e
 }
 
-func (e *env) load(name string) Value {
-	return e.vars[name]
+type (
+	continueSignal struct{ label varName } // Empty label targets innermost loop.
+	breakSignal    struct{ label varName }
+	throwSignal    struct{ err *RuntimeError }
+	returnSignal   struct{ value Value }
+	chainSignal    empty // Optional link short-circuits the chain.
+)
+
+// RuntimeError is value thrown by script or failed operation, it is
+// returned by interpreter when script does not catch it. Its Pos and End
+// methods return location of the failed expression, line is zero for
+// failed Call outside of script.
+type RuntimeError struct {
+	span
+	Message string
+	Value   Value        // Thrown value, message string for failed operations.
+	Trace   []TraceFrame // Innermost call first, script is the last.
 }
 
-type (
-	continueSignal empty
-	breakSignal    empty
-	throwSignal    Value
-	returnSignal   Value
+// TraceFrame is function call that was active when error was thrown.
+type TraceFrame struct {
+	Function string
+	Line     int // Zero if it is unknown.
+}
+
+func (re *RuntimeError) Error() string {
+	var sb strings.Builder
+	if re.file == nil { // Raised by Call outside of script.
+		sb.WriteString(re.Message)
+	} else {
+		fmt.Fprintf(&sb, "%s: %s\n%s", re.span, re.Message, re.excerpt())
+	}
+	for i, frame := range re.Trace {
+		if i == traceShownMax {
+			fmt.Fprintf(&sb, "\n  ... %d more", len(re.Trace)-i)
+			break
+		}
+		if frame.Line == 0 { // Called from Go.
+			fmt.Fprintf(&sb, "\n  at %s", frame.Function)
+			continue
+		}
+		fmt.Fprintf(&sb, "\n  at %s (line %d)", frame.Function, frame.Line)
+	}
+	return sb.String()
+}
+
+// InternalError is interpreter fault, it is bug in the interpreter or in
+// the native function.
+type InternalError struct {
+	Fault any    // Recovered panic value.
+	Stack []byte // Go stack trace of the panic.
+}
+
+func (ie *InternalError) Error() string {
+	return fmt.Sprintf("internal error: %v", ie.Fault)
+}
+
+const traceShownMax = 16 // Printed trace frames, deep traces are cut.
+
+var errStackOverflow = errors.New("stack overflow")
+
+// callSite is function call active in tree-walking evaluator.
+type callSite struct {
+	function string
+	at       astNode // Nil for calls from Go.
+}
+
+// receiver is bound to `this` and `super` of the called function.
+type receiver struct {
+	this  Value
+	super Value // Prototype of the table where method is found.
+}
+
+// noReceiver is receiver of plain function calls.
+var noReceiver = receiver{Nihil{}, Nihil{}}
+
+// Backend selects how interpreter executes scripts.
+type Backend int
+
+const (
+	BackendTree Backend = iota // Evaluates syntax tree.
+	BackendVM                  // Compiles to bytecode and runs stack machine.
 )
 
+// Options selects language modes and debug output of the interpreter.
+type Options struct {
+	AutoSemicolons bool // Inserts semicolons at line ends.
+	ObjectOriented bool // Allows class syntax.
+	ArrowFunctions bool // Allows `function() => value` and `() => value`.
+
+	PrintTokens bool // Prints scanned tokens.
+	PrintAst    bool // Prints parsed syntax tree.
+	PrintCode   bool // Prints compiled bytecode.
+}
+
 type Interpreter struct {
-	global *Table
-	module *Table
-	env
-	callStack int
-	callArgs  []Value // Using only for native functions.
+	global    *Table
+	module    *Table
+	env       *env
+	backend   Backend
+	callStack []callSite
+	depth     int // Active closure calls of both backends.
+	options   Options
 }
 
-func NewInterpreter() *Interpreter {
-	return &Interpreter{
+func NewInterpreter(options Options) *Interpreter {
+	it := &Interpreter{
 		global:    &Table{Proto: nil, Pairs: make(map[String]Value)},
 		module:    &Table{Proto: nil, Pairs: make(map[String]Value)},
-		env:       env{encl: nil, vars: make(map[string]Value)},
-		callStack: 0,
-		callArgs:  []Value{},
+		env:       nil,
+		backend:   BackendTree,
+		callStack: make([]callSite, 0),
+		options:   options,
 	}
+	it.RegisterFunc("print", nativePrint)
+	it.RegisterFunc("clock", nativeClock)
+	return it
 }
 
-func (it *Interpreter) GetArg(index int) Value {
-	if index < 0 || index > len(it.callArgs)-1 {
-		return Nihil{}
+// SetGlobal defines or overwrites global variable, nil value is stored
+// as void.
+func (it *Interpreter) SetGlobal(name string, value Value) {
+	if value == nil {
+		value = Nihil{}
 	}
-	return it.callArgs[index]
+	it.global.Pairs[String(name)] = value
 }
 
-func (it *Interpreter) Interpret(source []byte) {
-	it.env.vars["print"] = &Native{fn: nativePrint}
-	s := newScanner(source)
-	p := newParser(s)
+// GetGlobal returns value of global variable, false if it is not defined.
+func (it *Interpreter) GetGlobal(name string) (Value, bool) {
+	value, ok := it.global.Pairs[String(name)]
+	return value, ok
+}
+
+// RegisterFunc defines global native function.
+func (it *Interpreter) RegisterFunc(name string, fn NativeFunc) {
+	it.SetGlobal(name, NewNative(name, fn))
+}
+
+// SetBackend selects BackendTree or BackendVM, BackendTree is default.
+// Backend is used by the next Interpret call, functions defined before
+// keep running on the backend that created them.
+func (it *Interpreter) SetBackend(backend Backend) {
+	it.backend = backend
+}
+
+// Interpret runs the script and returns value of its last statement if
+// it is an expression, void otherwise. Syntax errors are returned as
+// ParseErrors or ResolveErrors, bytecode limits exceeded on vm backend as
+// CompileError, uncaught throws and failed operations as *RuntimeError,
+// interpreter faults as *InternalError.
+func (it *Interpreter) Interpret(source []byte) (Value, error) {
+	return it.InterpretNamed("script", source)
+}
+
+// InterpretNamed is Interpret with the script name used in diagnostics.
+func (it *Interpreter) InterpretNamed(
+	name string,
+	source []byte,
+) (
+	value Value,
+	err error,
+) {
+	defer it.recoverFault(it.env, len(it.callStack), it.depth, &value, &err)
+
+	file := &sourceFile{name: name, text: source}
+	s := newScanner(file, it.options)
+	p := newParser(s, it.options)
 	tree, err := p.Parse()
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
+	}
+	if err := newResolver().Resolve(tree); err != nil {
+		return nil, err
+	}
+	if it.options.PrintAst {
+		fmt.Print((&printer{}).print(tree))
+	}
+
+	switch it.backend {
+	case BackendTree:
+		return it.evalScript(tree)
+	case BackendVM:
+		code, err := newCompiler("script").Compile(tree)
+		if err != nil {
+			return nil, err
+		}
+		if it.options.PrintCode {
+			fmt.Print(code.disassemble())
+		}
+		return newVM(it).runScript(code)
+	default:
+		panic(unreachable)
 	}
-	for _, node := range tree {
-		it.eval(node)
+}
+
+// Call calls script function or native with the arguments. Values thrown
+// by the function, exceeded call depth and callee that is not a function
+// are returned as *RuntimeError, interpreter faults as *InternalError.
+// Errors returned by natives are returned as is.
+func (it *Interpreter) Call(fn Value, args ...Value) (value Value, err error) {
+	defer it.recoverFault(it.env, len(it.callStack), it.depth, &value, &err)
+
+	value, err = it.callMethod(fn, noReceiver, args)
+	if _, ok := fn.(*Native); ok || err == nil {
+		return value, err
+	}
+	var re *RuntimeError
+	if errors.As(err, &re) {
+		return nil, err
+	}
+	// Call from Go has no location in the script.
+	return nil, &RuntimeError{
+		Message: err.Error(),
+		Value:   String(err.Error()),
+		Trace:   []TraceFrame{},
+	}
+}
+
+// callMethod calls function with the receiver bound to its `this` and
+// `super`, it is used by both backends to call each other functions.
+// Faults are recovered only by public entry points.
+func (it *Interpreter) callMethod(
+	fn Value,
+	recv receiver,
+	args []Value,
+) (Value, error) {
+	return it.callFrom(nil, fn, recv, args)
+}
+
+// callFrom is callMethod with the call site of script function called by
+// tree-walking evaluator, such as iterator function of foreach.
+func (it *Interpreter) callFrom(
+	at astNode,
+	fn Value,
+	recv receiver,
+	args []Value,
+) (value Value, err error) {
+	switch fn := fn.(type) {
+	case *Native:
+		value, err = fn.fn(it, args)
+		if err == nil && value == nil {
+			value = Nihil{}
+		}
+		return value, err
+	case *Closure:
+		if it.depth >= callDepthMax {
+			return nil, errStackOverflow
+		}
+		if fn.code != nil {
+			return newVM(it).callClosure(fn, recv, args)
+		}
+		defer catch(func(throw throwSignal) { value, err = nil, throw.err })
+		return it.call(at, fn, recv, args), nil
+	default:
+		return nil, fmt.Errorf("cannot call %s", fn.typeOf())
+	}
+}
+
+// recoverFault turns panic into *InternalError and restores evaluator
+// state saved before the failed call. Fault of the nested entry point
+// keeps its Go stack.
+func (it *Interpreter) recoverFault(
+	env *env,
+	calls int,
+	depth int,
+	value *Value,
+	err *error,
+) {
+	if p := recover(); p != nil {
+		it.env = env
+		it.callStack = it.callStack[:calls]
+		it.depth = depth
+		ie, ok := p.(*InternalError)
+		if !ok {
+			ie = &InternalError{Fault: p, Stack: debug.Stack()}
+		}
+		*value, *err = nil, ie
+	}
+}
+
+// panicFault propagates fault returned by the nested entry point, such as
+// Call from native, to the outer one, scripts can not catch it.
+func panicFault(err error) {
+	var ie *InternalError
+	if errors.As(err, &ie) {
+		panic(ie)
+	}
+}
+
+// InterpretReader reads the whole script and interprets it.
+func (it *Interpreter) InterpretReader(name string, r io.Reader) (Value, error) {
+	source, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
 	}
+	return it.InterpretNamed(name, source)
+}
+
+func (it *Interpreter) evalScript(script []astDecl) (value Value, err error) {
+	defer catch(func(throw throwSignal) { value, err = nil, throw.err })
+
+	for _, node := range script {
+		value = it.eval(node)
+	}
+	if value == nil { // Last statement is not expression.
+		value = Nihil{}
+	}
+	return value, nil
+}
+
+// throw raises value at the node, trace is captured before the stack
+// is unwound.
+func (it *Interpreter) throw(at astNode, message string, value Value) {
+	panic(throwSignal{&RuntimeError{
+		span:    at.nodeSpan(),
+		Message: message,
+		Value:   value,
+		Trace:   it.trace(at),
+	}})
+}
+
+// raise throws failed operation error as its message string, runtime
+// errors returned by natives are rethrown, their trace includes calls
+// below the native already.
+func (it *Interpreter) raise(at astNode, err error) {
+	panicFault(err)
+	if re, ok := thrownError(err); ok {
+		panic(throwSignal{re})
+	}
+	it.throw(at, err.Error(), String(err.Error()))
+}
+
+// thrownError returns runtime error thrown by the script. Error of Call
+// without location in the script fails at the call site like operation.
+func thrownError(err error) (*RuntimeError, bool) {
+	var re *RuntimeError
+	if errors.As(err, &re) && re.file != nil {
+		return re, true
+	}
+	return nil, false
+}
+
+// trace lists active calls, line of the frame called from Go is unknown
+// and is zero.
+func (it *Interpreter) trace(at astNode) []TraceFrame {
+	trace := make([]TraceFrame, 0, len(it.callStack)+1)
+	line := at.nodeSpan().start.line
+	for i := len(it.callStack) - 1; i >= 0; i-- {
+		call := it.callStack[i]
+		trace = append(trace, TraceFrame{call.function, line})
+		if call.at != nil {
+			line = call.at.nodeSpan().start.line
+		} else if i == 0 { // Host called function outside of script.
+			return trace
+		} else {
+			line = 0
+		}
+	}
+	return append(trace, TraceFrame{"script", line})
 }
 
 func (it *Interpreter) eval(node astNode) Value {
@@ -74,11 +396,13 @@ func (it *Interpreter) eval(node astNode) Value {
 		panic(unreachable)
 	case *variableDecl:
 		for _, decl := range node.vars {
-			it.define(decl.name, it.eval(decl.init))
+			it.define(decl.name, decl.slot, it.eval(decl.init))
 		}
 		return nil
 	case *functionDecl:
-		it.define(node.name, it.eval(node.function))
+		closure := it.functionLit(node.function)
+		closure.name = node.name
+		it.define(node.name, node.slot, closure)
 		return nil
 	case *stmtDecl:
 		return it.eval(node.stmt)
@@ -86,6 +410,8 @@ func (it *Interpreter) eval(node astNode) Value {
 	case *emptyStmt:
 		return nil
 	case *blockStmt:
+		it.beginScope(node.slots)
+		defer it.endScope()
 		for _, decl := range node.block {
 			it.eval(decl)
 		}
@@ -100,16 +426,20 @@ func (it *Interpreter) eval(node astNode) Value {
 		return it.whileStmt(node)
 	case *doStmt:
 		return it.doStmt(node)
+	case *switchStmt:
+		return it.switchStmt(node)
 	case *continueStmt:
-		panic(continueSignal{})
+		panic(continueSignal{node.label})
 	case *breakStmt:
-		panic(breakSignal{})
+		panic(breakSignal{node.label})
 	case *throwStmt:
-		panic(throwSignal(it.eval(node.throw)))
+		value := it.eval(node.throw)
+		it.throw(node, value.String(), value)
+		return nil
 	case *tryStmt:
 		return it.tryStmt(node)
 	case *returnStmt:
-		panic(returnSignal(it.eval(node.value)))
+		panic(returnSignal{it.eval(node.value)})
 	case *exprStmt:
 		return it.eval(node.expr)
 		/* == expressions ======================================================= */
@@ -121,25 +451,36 @@ func (it *Interpreter) eval(node astNode) Value {
 		return it.prefixExpr(node)
 	case *infixExpr:
 		return it.infixExpr(node)
+	case *logicalExpr:
+		return it.logicalExpr(node)
+	case *condExpr:
+		if testValue(it.eval(node.cond)) {
+			return it.eval(node.then)
+		}
+		return it.eval(node.else_)
 	case *postfixExpr:
-		return nil
+		return it.increment(node, node.left, node.op.tokenType, true)
 	case *callExpr:
 		return it.callExpr(node)
 	case *indexExpr:
-		return loadIndex(
-			it.eval(node.left),
-			it.eval(node.index),
-		)
+		object := it.link(node.left, node.optional)
+		value, err := loadIndex(object, it.eval(node.index))
+		if err != nil {
+			it.raise(node, err)
+		}
+		return value
+	case *chainExpr:
+		return it.chainExpr(node)
 	case *protoTableExpr:
-		tbl := it.tableLit(node.table)
 		proto := it.eval(node.proto)
-		if proto, ok := proto.(*Table); !ok {
-			tbl.Proto = proto
+		tbl := it.tableLit(node.table)
+		if err := inherit(tbl, proto); err != nil {
+			it.raise(node, err)
 		}
-		panic("ERROR")
+		return tbl
 
 	case *identifierLit:
-		return it.load(node.varName)
+		return it.load(node)
 	case *nihilLit:
 		return Nihil{}
 	case *booleanLit:
@@ -158,19 +499,75 @@ func (it *Interpreter) eval(node astNode) Value {
 	default:
 		panic(unreachable)
 	}
-	panic(unreachable)
 }
 
-func (it *Interpreter) beginScope() {
-	it.env = env{encl: &it.env, vars: make(map[string]Value)}
+func (it *Interpreter) beginScope(size int) {
+	it.env = newEnv(it.env, size)
 }
 
 func (it *Interpreter) endScope() {
-	it.env = *it.env.encl
+	it.env = it.env.encl
+}
+
+// define initializes declared variable, negative slot means global.
+func (it *Interpreter) define(name varName, slot int, value Value) {
+	if slot < 0 {
+		it.global.Pairs[String(name)] = value
+	} else {
+		it.env.slots[slot] = value
+	}
+}
+
+func (it *Interpreter) load(node *identifierLit) Value {
+	if node.depth < 0 {
+		value, ok := it.global.Pairs[String(node.varName)]
+		if !ok {
+			it.raise(node, fmt.Errorf("undefined variable '%s'", node.varName))
+		}
+		return value
+	}
+	value := it.env.ancestor(node.depth).slots[node.slot]
+	if value == nil {
+		it.raise(node, fmt.Errorf("variable '%s' is not initialized", node.varName))
+	}
+	return value
+}
+
+func (it *Interpreter) store(node *identifierLit, value Value) {
+	if node.depth < 0 {
+		if _, ok := it.global.Pairs[String(node.varName)]; !ok {
+			it.raise(node, fmt.Errorf("undefined variable '%s'", node.varName))
+		}
+		it.global.Pairs[String(node.varName)] = value
+		return
+	}
+	scope := it.env.ancestor(node.depth)
+	if scope.slots[node.slot] == nil {
+		it.raise(node, fmt.Errorf("variable '%s' is not initialized", node.varName))
+	}
+	scope.slots[node.slot] = value
+}
+
+// breakTo returns handler of break signal that rethrows signals targeting
+// other statement.
+func breakTo(label varName) func(breakSignal) {
+	return func(signal breakSignal) {
+		if signal.label != "" && signal.label != label {
+			panic(signal)
+		}
+	}
+}
+
+func continueTo(label varName) func(continueSignal) {
+	return func(signal continueSignal) {
+		if signal.label != "" && signal.label != label {
+			panic(signal)
+		}
+	}
 }
 
 func (it *Interpreter) ifStmt(node *ifStmt) Value {
-	it.beginScope()
+	it.beginScope(node.slots)
 	defer it.endScope()
 	it.eval(node.init)
 	if testValue(it.eval(node.cond)) {
@@ -182,13 +579,13 @@ func (it *Interpreter) ifStmt(node *ifStmt) Value {
 }
 
 func (it *Interpreter) forStmt(node *forStmt) Value {
-	defer catch(func(_ breakSignal) {})
-	it.beginScope()
+	defer catch(breakTo(node.label))
+	it.beginScope(node.slots)
 	defer it.endScope()
 	it.eval(node.init)
 	for testValue(it.eval(node.cond)) {
 		func() {
-			defer catch(func(_ continueSignal) {})
+			defer catch(continueTo(node.label))
 			it.eval(node.loop)
 		}()
 		it.eval(node.post)
@@ -197,14 +594,40 @@ func (it *Interpreter) forStmt(node *forStmt) Value {
 }
 
 func (it *Interpreter) forEachStmt(node *forEachStmt) Value {
-	return nil
+	iter, err := newIterator(it.eval(node.iter))
+	if err != nil {
+		it.raise(node.iter, err)
+	}
+
+	defer catch(breakTo(node.label))
+	for {
+		key, value, ok, err := iter.next(it, node.iter)
+		if err != nil {
+			it.raise(node.iter, err)
+		}
+		if !ok {
+			return nil
+		}
+		func() {
+			it.beginScope(node.slots)
+			defer it.endScope()
+			if node.key != "" {
+				it.env.slots[0] = key
+				it.env.slots[1] = value
+			} else {
+				it.env.slots[0] = value
+			}
+			defer catch(continueTo(node.label))
+			it.eval(node.loop)
+		}()
+	}
 }
 
 func (it *Interpreter) whileStmt(node *whileStmt) Value {
-	defer catch(func(_ breakSignal) {})
+	defer catch(breakTo(node.label))
 	for testValue(it.eval(node.cond)) {
 		func() {
-			defer catch(func(_ continueSignal) {})
+			defer catch(continueTo(node.label))
 			it.eval(node.loop)
 		}()
 	}
@@ -212,10 +635,10 @@ func (it *Interpreter) whileStmt(node *whileStmt) Value {
 }
 
 func (it *Interpreter) doStmt(node *doStmt) Value {
-	defer catch(func(_ breakSignal) {})
+	defer catch(breakTo(node.label))
 	for {
 		func() {
-			defer catch(func(_ continueSignal) {})
+			defer catch(continueTo(node.label))
 			it.eval(node.loop)
 		}()
 		if !testValue(it.eval(node.cond)) {
@@ -225,6 +648,35 @@ func (it *Interpreter) doStmt(node *doStmt) Value {
 	return nil
 }
 
+// switchStmt runs the first case with value equal to the switch value, or
+// the default case. Cases do not fall through.
+func (it *Interpreter) switchStmt(node *switchStmt) Value {
+	value := it.eval(node.value)
+	defer catch(breakTo(node.label))
+
+	var defaultBody *blockStmt
+	for _, clause := range node.cases {
+		if len(clause.values) == 0 {
+			defaultBody = clause.body
+			continue
+		}
+		for _, caseValue := range clause.values {
+			equal, err := infixOp(tokenEqEq, value, it.eval(caseValue))
+			if err != nil {
+				it.raise(caseValue, err)
+			}
+			if testValue(equal) {
+				it.eval(clause.body)
+				return nil
+			}
+		}
+	}
+	if defaultBody != nil {
+		it.eval(defaultBody)
+	}
+	return nil
+}
+
 func (it *Interpreter) tryStmt(node *tryStmt) Value {
 	if node.finally != nil {
 		defer func() { it.eval(node.finally) }()
@@ -232,9 +684,13 @@ func (it *Interpreter) tryStmt(node *tryStmt) Value {
 
 	if node.catch != nil {
 		defer catch(func(throw throwSignal) {
-			it.beginScope()
+			if node.as != "" {
+				it.beginScope(1)
+				it.env.slots[0] = throw.err.Value
+			} else {
+				it.beginScope(0)
+			}
 			defer it.endScope()
-			it.define(node.as, throw)
 			it.eval(node.catch)
 		})
 	}
@@ -245,117 +701,267 @@ func (it *Interpreter) tryStmt(node *tryStmt) Value {
 
 func (it *Interpreter) tableLit(node *tableLit) *Table {
 	tbl := &Table{Proto: nil, Pairs: make(map[String]Value)}
-	for k, v := range node.pairs {
-		tbl.Pairs[String(it.eval(k).String())] = it.eval(v)
+	for _, pair := range node.pairs {
+		if pair.key == nil {
+			if err := spread(tbl, it.eval(pair.value)); err != nil {
+				it.raise(pair.value, err)
+			}
+			continue
+		}
+		key, err := tableKey(it.eval(pair.key))
+		if err != nil {
+			it.raise(pair.key, err)
+		}
+		tbl.store(key, it.eval(pair.value))
 	}
 	for i, v := range node.array {
-		tbl.Pairs[String(Number(i).String())] = it.eval(v)
+		tbl.store(String(Number(i).String()), it.eval(v))
 	}
 	return tbl
 }
 
 func (it *Interpreter) functionLit(node *functionLit) *Closure {
 	return &Closure{
+		name:    cmp.Or(node.name, stringFunction),
 		closure: it.env,
 		params:  node.params,
+		slots:   node.slots,
 		block:   node.body,
 	}
 }
 
-func (it *Interpreter) assignExpr(node *assignExpr) Value {
-	value := it.eval(node.right)
-	switch left := node.left.(type) {
+// target is assignment target, object and key of the index target are
+// evaluated only once.
+type target struct {
+	name   *identifierLit // Nil for index target.
+	object Value
+	key    Value
+}
+
+func (it *Interpreter) target(node astExpr) target {
+	switch node := node.(type) {
 	case *identifierLit:
-		it.store(left.varName, value)
+		return target{name: node}
 	case *indexExpr:
-		storeIndex(
-			it.eval(left.left),
-			it.eval(left.index),
-			value,
-		)
+		return target{object: it.eval(node.left), key: it.eval(node.index)}
 	default:
 		panic(unreachable)
 	}
-	return value
 }
 
-func (it *Interpreter) prefixExpr(node *prefixExpr) Value {
-	rVal := it.eval(node.right)
+func (it *Interpreter) loadTarget(at astNode, t target) Value {
+	if t.name != nil {
+		return it.load(t.name)
+	}
+	value, err := loadIndex(t.object, t.key)
+	if err != nil {
+		it.raise(at, err)
+	}
+	return value
+}
 
-	switch node.op.tokenType {
-	case tokenMinus:
-		return -rVal.(Number)
-	case tokenPlus:
-		return +rVal.(Number)
+func (it *Interpreter) storeTarget(at astNode, t target, value Value) {
+	if t.name != nil {
+		it.store(t.name, value)
+		return
+	}
+	if err := storeIndex(t.object, t.key, value); err != nil {
+		it.raise(at, err)
+	}
+}
 
-	case tokenExcl:
-		return Boolean(testValue(rVal))
+// assignExpr stores right value, compound assignment combines it with the
+// current value. Logical assignment does not store if it short-circuits.
+func (it *Interpreter) assignExpr(node *assignExpr) Value {
+	t := it.target(node.left)
+	if node.op.tokenType == tokenEq {
+		value := it.eval(node.right)
+		it.storeTarget(node, t, value)
+		return value
+	}
 
+	current := it.loadTarget(node, t)
+	op := compoundOps[node.op.tokenType]
+	var value Value
+	switch op {
+	case tokenAmperAmper, tokenPipePipe, tokenQuestQuest:
+		if isShortCircuit(op, current) {
+			return current
+		}
+		value = it.eval(node.right)
 	default:
-		panic(unreachable)
+		var err error
+		value, err = infixOp(op, current, it.eval(node.right))
+		if err != nil {
+			it.raise(node, err)
+		}
 	}
+	it.storeTarget(node, t, value)
+	return value
 }
 
-func (it *Interpreter) infixExpr(node *infixExpr) Value {
-	lVal := it.eval(node.left)
-	rVal := it.eval(node.right)
+// increment evaluates '++' and '--', postfix form returns the value before
+// increment.
+func (it *Interpreter) increment(
+	node astExpr, operand astExpr, op tokenType, isPostfix bool,
+) Value {
+	t := it.target(operand)
+	current := it.loadTarget(node, t)
+	value, err := prefixOp(op, current)
+	if err != nil {
+		it.raise(node, err)
+	}
+	it.storeTarget(node, t, value)
+	if isPostfix {
+		return current
+	}
+	return value
+}
 
+func (it *Interpreter) prefixExpr(node *prefixExpr) Value {
 	switch node.op.tokenType {
-	case tokenEq:
-		return Boolean(rVal == lVal)
-	case tokenExclEq:
-		return Boolean(rVal != lVal)
+	case tokenPlusPlus, tokenMinusMinus:
+		return it.increment(node, node.right, node.op.tokenType, false)
+	}
+	value, err := prefixOp(node.op.tokenType, it.eval(node.right))
+	if err != nil {
+		it.raise(node, err)
+	}
+	return value
+}
 
-	case tokenLAngle:
-		return Boolean(rVal.(Number) < lVal.(Number))
-	case tokenLAngleEq:
-		return Boolean(rVal.(Number) <= lVal.(Number))
-	case tokenRAngle:
-		return Boolean(rVal.(Number) > lVal.(Number))
-	case tokenRAngleEq:
-		return Boolean(rVal.(Number) >= lVal.(Number))
+func (it *Interpreter) infixExpr(node *infixExpr) Value {
+	left := it.eval(node.left)
+	value, err := infixOp(node.op.tokenType, left, it.eval(node.right))
+	if err != nil {
+		it.raise(node, err)
+	}
+	return value
+}
 
-	case tokenPlus:
-		return rVal.(Number) + lVal.(Number)
-	case tokenMinus:
-		return rVal.(Number) - lVal.(Number)
-	case tokenStar:
-		return rVal.(Number) * lVal.(Number)
-	case tokenSlash:
-		return rVal.(Number) / lVal.(Number)
-	case tokenPercent:
-		return Number(math.Mod(float64(rVal.(Number)), float64(lVal.(Number))))
+func (it *Interpreter) logicalExpr(node *logicalExpr) Value {
+	left := it.eval(node.left)
+	if isShortCircuit(node.op.tokenType, left) {
+		return left
+	}
+	return it.eval(node.right)
+}
 
+// isShortCircuit reports whether left operand is the result of logical
+// operator, so right one is not evaluated.
+func isShortCircuit(op tokenType, left Value) bool {
+	switch op {
+	case tokenAmperAmper:
+		return !testValue(left)
+	case tokenPipePipe:
+		return testValue(left)
+	case tokenQuestQuest:
+		_, ok := left.(Nihil)
+		return !ok
 	default:
 		panic(unreachable)
 	}
 }
 
-func (it *Interpreter) callExpr(node *callExpr) (value Value) {
-	callee := it.eval(node.left)
-	args := []Value{}
-	for _, arg := range node.args {
-		args = append(args, it.eval(arg))
+func (it *Interpreter) chainExpr(node *chainExpr) (value Value) {
+	defer catch(func(_ chainSignal) { value = Nihil{} })
+	return it.eval(node.expr)
+}
+
+// link evaluates left side of index or call, optional link short-circuits
+// the chain if it is void.
+func (it *Interpreter) link(left astExpr, optional bool) Value {
+	value := it.eval(left)
+	if _, ok := value.(Nihil); ok && optional {
+		panic(chainSignal{})
 	}
+	return value
+}
 
+func (it *Interpreter) callExpr(node *callExpr) Value {
+	callee, recv := it.callee(node)
+	args := make([]Value, len(node.args))
+	for i, arg := range node.args {
+		args[i] = it.eval(arg)
+	}
+	return it.call(node, callee, recv, args)
+}
+
+// callee evaluates the called value, index callee is a method and it is
+// called with the receiver.
+func (it *Interpreter) callee(node *callExpr) (callee Value, recv receiver) {
+	if index, ok := node.left.(*indexExpr); ok {
+		object := it.link(index.left, index.optional)
+		var err error
+		callee, recv, err = loadMethod(object, it.eval(index.index))
+		if err != nil {
+			it.raise(index, err)
+		}
+	} else {
+		callee, recv = it.eval(node.left), noReceiver
+	}
+	if node.this != nil { // Super method is called on `this`.
+		recv.this = it.load(node.this)
+	}
+	if _, ok := callee.(Nihil); ok && node.optional {
+		panic(chainSignal{})
+	}
+	return callee, recv
+}
+
+// call calls the callee from the call site, which is nil for calls from
+// Go, those check callee and stack depth themselves.
+func (it *Interpreter) call(
+	at astNode,
+	callee Value,
+	recv receiver,
+	args []Value,
+) (
+	value Value,
+) {
 	switch callee := callee.(type) {
 	case *Native:
-		return callee.fn(it, args)
+		it.callStack = append(it.callStack, callSite{callee.name, at})
+		defer func() { it.callStack = it.callStack[:len(it.callStack)-1] }()
+
+		value, err := callee.fn(it, args)
+		if err != nil {
+			it.raise(at, err)
+		}
+		if value == nil {
+			return Nihil{}
+		}
+		return value
 	case *Closure:
+		if callee.code != nil { // Compiled by vm backend.
+			value, err := it.callMethod(callee, recv, args)
+			if err != nil {
+				it.raise(at, err)
+			}
+			return value
+		}
+		if it.depth >= callDepthMax {
+			it.raise(at, errStackOverflow)
+		}
+		it.depth++
+		defer func() { it.depth-- }()
+		it.callStack = append(it.callStack, callSite{callee.name, at})
+		defer func() { it.callStack = it.callStack[:len(it.callStack)-1] }()
+
 		// Use function closure.
 		savedEnv := it.env
 		it.env = callee.closure
 		defer func() { it.env = savedEnv }()
 
 		// Create function environment.
-		it.beginScope()
+		it.beginScope(callee.slots)
 		defer it.endScope()
 
 		// Load args in function environment.
-		it.loadArgs(callee.params, node.args)
+		loadArgs(it.env, callee.params, recv, args)
 
 		// Catching return value.
-		defer catch(func(ret returnSignal) { value = ret })
+		defer catch(func(ret returnSignal) { value = ret.value })
 
 		// Eval function body.
 		for _, node := range callee.block {
@@ -365,26 +971,238 @@ func (it *Interpreter) callExpr(node *callExpr) (value Value) {
 		// Default return is nihil.
 		return Nihil{}
 	default:
-		panic("ERROR")
+		it.raise(at, fmt.Errorf("cannot call %s", callee.typeOf()))
+		return nil
 	}
 }
 
-func (it *Interpreter) loadArgs(params []varName, args []astExpr) {
-	for i, param := range params {
+// loadArgs stores args in first slots of function environment, receiver
+// takes two slots after them.
+func loadArgs(env *env, params []varName, recv receiver, args []Value) {
+	for i := range params {
 		if i < len(args) {
-			it.define(param, it.eval(args[i]))
+			env.slots[i] = args[i]
 		} else {
-			it.define(param, Nihil{})
+			env.slots[i] = Nihil{}
+		}
+	}
+	env.slots[len(params)] = recv.this
+	env.slots[len(params)+1] = recv.super
+}
+
+/* == operators ============================================================= */
+
+func prefixOp(op tokenType, right Value) (Value, error) {
+	switch op {
+	case tokenMinus, tokenPlus, tokenTilde, tokenPlusPlus, tokenMinusMinus:
+		r, ok := right.(Number)
+		if !ok {
+			return nil, fmt.Errorf(
+				"operand of '%s' must be number, got %s",
+				op, right.typeOf(),
+			)
 		}
+		switch op {
+		case tokenMinus:
+			return -r, nil
+		case tokenTilde:
+			return Number(^toInt32(r)), nil
+		case tokenPlusPlus:
+			return r + 1, nil
+		case tokenMinusMinus:
+			return r - 1, nil
+		}
+		return r, nil
+
+	case tokenExcl:
+		return Boolean(!testValue(right)), nil
+
+	default:
+		panic(unreachable)
 	}
-	if len(params) < len(args) {
-		for i := len(params); i < len(args); i++ {
-			it.eval(args[i])
+}
+
+func infixOp(op tokenType, left Value, right Value) (Value, error) {
+	switch op {
+	case tokenEqEq:
+		return Boolean(valuesEqual(left, right)), nil
+	case tokenExclEq:
+		return Boolean(!valuesEqual(left, right)), nil
+	case tokenLAngle, tokenLAngleEq, tokenRAngle, tokenRAngleEq:
+		return compareOp(op, left, right)
+	}
+
+	l, lok := left.(Number)
+	r, rok := right.(Number)
+	if !lok || !rok {
+		return nil, fmt.Errorf(
+			"operands of '%s' must be numbers, got %s and %s",
+			op, left.typeOf(), right.typeOf(),
+		)
+	}
+
+	switch op {
+	case tokenPlus:
+		return l + r, nil
+	case tokenMinus:
+		return l - r, nil
+	case tokenStar:
+		return l * r, nil
+	case tokenSlash:
+		return l / r, nil
+	case tokenPercent:
+		return Number(math.Mod(float64(l), float64(r))), nil
+
+	case tokenPipe:
+		return Number(toInt32(l) | toInt32(r)), nil
+	case tokenAmper:
+		return Number(toInt32(l) & toInt32(r)), nil
+	case tokenCircum:
+		return Number(toInt32(l) ^ toInt32(r)), nil
+	case tokenLAngleAngle:
+		return Number(toInt32(l) << shiftCount(r)), nil
+	case tokenRAngleAngle:
+		return Number(toInt32(l) >> shiftCount(r)), nil
+
+	default:
+		panic(unreachable)
+	}
+}
+
+// toInt32 converts number for bitwise operators like JavaScript ToInt32:
+// fraction is truncated and the integer wraps modulo 2^32, NaN and
+// infinities are 0.
+func toInt32(n Number) int32 {
+	f := float64(n)
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0
+	}
+	return int32(int64(math.Mod(math.Trunc(f), 1<<32)))
+}
+
+// shiftCount uses only five low bits of the count, so shift is in 0..31.
+func shiftCount(n Number) uint {
+	return uint(toInt32(n) & 31)
+}
+
+// valuesEqual reports whether values are of the same type and equal, tables
+// and functions are equal only to themselves.
+func valuesEqual(left Value, right Value) bool {
+	return left == right
+}
+
+// compareOp orders two numbers or two strings, strings are compared
+// lexicographically by bytes.
+func compareOp(op tokenType, left Value, right Value) (Value, error) {
+	switch l := left.(type) {
+	case Number:
+		if r, ok := right.(Number); ok {
+			return Boolean(compare(op, l, r)), nil
+		}
+	case String:
+		if r, ok := right.(String); ok {
+			return Boolean(compare(op, l, r)), nil
 		}
 	}
+	return nil, fmt.Errorf(
+		"cannot compare %s and %s with '%s'",
+		left.typeOf(), right.typeOf(), op,
+	)
 }
 
-func storeIndex(object Value, index Value, value Value) {}
-func loadIndex(object Value, index Value) Value {
+func compare[T cmp.Ordered](op tokenType, l T, r T) bool {
+	switch op {
+	case tokenLAngle:
+		return l < r
+	case tokenLAngleEq:
+		return l <= r
+	case tokenRAngle:
+		return l > r
+	case tokenRAngleEq:
+		return l >= r
+	default:
+		panic(unreachable)
+	}
+}
+
+// inherit sets prototype of the table created by prototype table
+// expression.
+func inherit(table *Table, proto Value) error {
+	tbl, ok := proto.(*Table)
+	if !ok {
+		return fmt.Errorf("prototype must be table, got %s", proto.typeOf())
+	}
+	table.Proto = tbl
 	return nil
 }
+
+// spread copies own pairs of the value to the table literal, void has no
+// pairs.
+func spread(table *Table, value Value) error {
+	switch value := value.(type) {
+	case *Table:
+		maps.Copy(table.Pairs, value.Pairs)
+	case Nihil:
+	default:
+		return fmt.Errorf("cannot spread %s", value.typeOf())
+	}
+	return nil
+}
+
+func storeIndex(object Value, index Value, value Value) error {
+	tbl, ok := object.(*Table)
+	if !ok {
+		return fmt.Errorf("cannot store index of %s", object.typeOf())
+	}
+	key, err := tableKey(index)
+	if err != nil {
+		return err
+	}
+	tbl.store(key, value)
+	return nil
+}
+
+// loadMethod loads method called on the object. Super of the receiver is
+// prototype of the table where method is found.
+func loadMethod(object Value, index Value) (Value, receiver, error) {
+	tbl, ok := object.(*Table)
+	if !ok {
+		return nil, receiver{}, fmt.Errorf(
+			"cannot load index of %s", object.typeOf(),
+		)
+	}
+	key, err := tableKey(index)
+	if err != nil {
+		return nil, receiver{}, err
+	}
+	method, holder := tbl.lookup(key)
+	recv := receiver{this: object, super: Nihil{}}
+	if holder != nil && holder.Proto != nil {
+		recv.super = holder.Proto
+	}
+	return method, recv, nil
+}
+
+func loadIndex(object Value, index Value) (Value, error) {
+	tbl, ok := object.(*Table)
+	if !ok {
+		return nil, fmt.Errorf("cannot load index of %s", object.typeOf())
+	}
+	key, err := tableKey(index)
+	if err != nil {
+		return nil, err
+	}
+	return tbl.load(key), nil
+}
+
+// tableKey converts index value to the string key of table pairs.
+func tableKey(index Value) (String, error) {
+	switch index := index.(type) {
+	case String:
+		return index, nil
+	case Number, Boolean:
+		return String(index.String()), nil
+	default:
+		return "", fmt.Errorf("invalid table key type %s", index.typeOf())
+	}
+}
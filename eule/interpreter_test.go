@@ -0,0 +1,303 @@
+package eule
+
+import (
+	"errors"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var backends = map[string]Backend{
+	"tree": BackendTree,
+	"vm":   BackendVM,
+}
+
+// forBackends runs the test with new interpreter on every backend.
+func forBackends(t *testing.T, test func(t *testing.T, it *Interpreter)) {
+	for name, backend := range backends {
+		t.Run(name, func(t *testing.T) {
+			it := NewInterpreter(Options{})
+			it.SetBackend(backend)
+			test(t, it)
+		})
+	}
+}
+
+func TestStackOverflowThroughNative(t *testing.T) {
+	forBackends(t, func(t *testing.T, it *Interpreter) {
+		it.RegisterFunc("callback", func(it *Interpreter, args []Value) (Value, error) {
+			return it.Call(args[0], args[0])
+		})
+		_, err := it.Interpret([]byte(`
+			function f(self) { return callback(self); }
+			f(f);
+		`))
+		var re *RuntimeError
+		if !errors.As(err, &re) {
+			t.Fatalf("want *RuntimeError, got %v", err)
+		}
+		if re.Message != "stack overflow" {
+			t.Errorf("want stack overflow, got %q", re.Message)
+		}
+		if it.depth != 0 {
+			t.Errorf("call depth is not restored: %d", it.depth)
+		}
+	})
+}
+
+func TestGlobals(t *testing.T) {
+	forBackends(t, func(t *testing.T, it *Interpreter) {
+		it.SetGlobal("answer", NewNumber(42))
+		it.RegisterFunc("double", func(it *Interpreter, args []Value) (Value, error) {
+			return args[0].(Number) * 2, nil
+		})
+		if _, err := it.Interpret([]byte("var result = double(answer);")); err != nil {
+			t.Fatal(err)
+		}
+		if v, ok := it.GetGlobal("result"); !ok || v != Number(84) {
+			t.Errorf("result: got %v, %v", v, ok)
+		}
+		if v, ok := it.GetGlobal("missing"); ok {
+			t.Errorf("missing: got %v", v)
+		}
+
+		it.SetGlobal("empty", nil)
+		v, err := it.Interpret([]byte("empty ?? 1;"))
+		if err != nil || v != Number(1) {
+			t.Errorf("nil global: got %v, %v", v, err)
+		}
+	})
+}
+
+func TestCall(t *testing.T) {
+	forBackends(t, func(t *testing.T, it *Interpreter) {
+		_, err := it.Interpret([]byte(`
+			function add(a, b) { return a + b; }
+			function fail(value) { throw value; }
+			function nothing() {}
+		`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		add, _ := it.GetGlobal("add")
+		if v, err := it.Call(add, NewNumber(1), NewNumber(2)); err != nil || v != Number(3) {
+			t.Errorf("add: got %v, %v", v, err)
+		}
+		nothing, _ := it.GetGlobal("nothing")
+		if v, err := it.Call(nothing); err != nil || v != (Nihil{}) {
+			t.Errorf("nothing: got %v, %v", v, err)
+		}
+
+		fail, _ := it.GetGlobal("fail")
+		_, err = it.Call(fail, NewString("oops"))
+		var re *RuntimeError
+		if !errors.As(err, &re) {
+			t.Fatalf("fail: want *RuntimeError, got %v", err)
+		}
+		if re.Value != String("oops") {
+			t.Errorf("fail: thrown value %v", re.Value)
+		}
+
+		_, err = it.Call(NewNumber(1))
+		if !errors.As(err, &re) || re.Message != "cannot call number" {
+			t.Errorf("number: got %v", err)
+		}
+	})
+}
+
+func TestNativeError(t *testing.T) {
+	errNative := errors.New("native failed")
+	forBackends(t, func(t *testing.T, it *Interpreter) {
+		it.RegisterFunc("native", func(it *Interpreter, args []Value) (Value, error) {
+			return nil, errNative
+		})
+		native, _ := it.GetGlobal("native")
+		if _, err := it.Call(native); err != errNative {
+			t.Errorf("Call: got %v", err)
+		}
+
+		// Scripts can catch native errors by their message.
+		v, err := it.Interpret([]byte(`
+			var caught;
+			try { native(); } catch (e) { caught = e; }
+			caught;
+		`))
+		if err != nil || v != String("native failed") {
+			t.Errorf("catch: got %v, %v", v, err)
+		}
+
+		_, err = it.Interpret([]byte("native();"))
+		var re *RuntimeError
+		if !errors.As(err, &re) || re.Message != "native failed" {
+			t.Errorf("uncaught: got %v", err)
+		}
+	})
+}
+
+func TestScriptErrors(t *testing.T) {
+	it := NewInterpreter(Options{})
+	_, err := it.Interpret([]byte("var = 1;\nprint(;"))
+	var parseErrs ParseErrors
+	if !errors.As(err, &parseErrs) || len(parseErrs) != 2 {
+		t.Fatalf("want 2 parse errors, got %v", err)
+	}
+	var parseErr ParseError
+	if !errors.As(err, &parseErr) || parseErr != parseErrs[0] {
+		t.Errorf("first parse error is not unwrapped: %v", parseErr)
+	}
+	second := parseErrs[1]
+	if want := (Position{"script", 2, 7, 15}); second.Pos() != want {
+		t.Errorf("parse error position: got %v, want %v", second.Pos(), want)
+	}
+	if second.Message != "expect expression" {
+		t.Errorf("parse error message: got %q", second.Message)
+	}
+
+	_, err = it.Interpret([]byte("{ var a = 1; var a = 2; var b = b; }"))
+	var resolveErrs ResolveErrors
+	if !errors.As(err, &resolveErrs) || len(resolveErrs) != 2 {
+		t.Fatalf("want 2 resolve errors, got %v", err)
+	}
+	if pos := resolveErrs[1].Pos(); pos.Line != 1 || pos.Column != 33 {
+		t.Errorf("resolve error position: got %v", pos)
+	}
+
+	_, err = it.Interpret([]byte("var a = 1;\na.b;"))
+	var re *RuntimeError
+	if !errors.As(err, &re) {
+		t.Fatalf("want *RuntimeError, got %v", err)
+	}
+	if pos, end := re.Pos(), re.End(); pos.Line != 2 || pos.Column != 1 || end.Column != 4 {
+		t.Errorf("runtime error span: got %v - %v", pos, end)
+	}
+
+	it.SetBackend(BackendVM)
+	args := strings.Repeat("1, ", 300)
+	_, err = it.Interpret([]byte("print;\nprint(" + args + "1);"))
+	var ce CompileError
+	if !errors.As(err, &ce) || ce.Message != "too many arguments" {
+		t.Fatalf("want CompileError, got %v", err)
+	}
+	if pos := ce.Pos(); pos.Line != 2 || pos.Column != 1 {
+		t.Errorf("compile error position: got %v", pos)
+	}
+}
+
+func TestNativeTrace(t *testing.T) {
+	forBackends(t, func(t *testing.T, it *Interpreter) {
+		it.RegisterFunc("fail", func(it *Interpreter, args []Value) (Value, error) {
+			return nil, errors.New("failed")
+		})
+		it.RegisterFunc("callback", func(it *Interpreter, args []Value) (Value, error) {
+			return it.Call(args[0])
+		})
+		tests := []struct {
+			script string
+			want   []TraceFrame
+		}{
+			{
+				"function f() {\n  fail();\n}\nf();",
+				[]TraceFrame{{"fail", 2}, {"f", 2}, {"script", 4}},
+			},
+			{
+				"function thrower() {\n  throw 1;\n}\ncallback(thrower);",
+				[]TraceFrame{{"thrower", 2}, {"callback", 0}, {"script", 4}},
+			},
+		}
+		for _, test := range tests {
+			_, err := it.Interpret([]byte(test.script))
+			var re *RuntimeError
+			if !errors.As(err, &re) {
+				t.Fatalf("want *RuntimeError, got %v", err)
+			}
+			if !slices.Equal(re.Trace, test.want) {
+				t.Errorf("%q: got trace %v, want %v", test.script, re.Trace, test.want)
+			}
+		}
+	})
+}
+
+func TestFaultIsNotCatchable(t *testing.T) {
+	scripts := map[string]string{
+		"native":   "boom();",
+		"foreach":  "foreach (var x in iter) {}",
+		"callback": "callback(function() { boom(); });",
+	}
+	forBackends(t, func(t *testing.T, it *Interpreter) {
+		it.RegisterFunc("boom", func(it *Interpreter, args []Value) (Value, error) {
+			panic("bug in native")
+		})
+		it.RegisterFunc("callback", func(it *Interpreter, args []Value) (Value, error) {
+			return it.Call(args[0])
+		})
+		iter := NewTable(nil)
+		iter.store("next", it.global.load("boom"))
+		it.SetGlobal("iter", iter)
+
+		for name, script := range scripts {
+			v, err := it.Interpret([]byte(
+				"var caught = false;\ntry { " + script + " } catch (e) { caught = true; }",
+			))
+			var ie *InternalError
+			if !errors.As(err, &ie) || ie.Fault != "bug in native" {
+				t.Errorf("%s: want *InternalError, got %v, %v", name, v, err)
+			}
+			if caught, _ := it.GetGlobal("caught"); caught != Boolean(false) {
+				t.Errorf("%s: fault is caught by script", name)
+			}
+			if it.depth != 0 || len(it.callStack) != 0 {
+				t.Errorf("%s: state is not restored", name)
+			}
+		}
+	})
+}
+
+func TestLambdaLookahead(t *testing.T) {
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	it := NewInterpreter(Options{
+		AutoSemicolons: true,
+		ArrowFunctions: true,
+		PrintTokens:    true,
+	})
+	v, err := it.Interpret([]byte("var add = (a, b)\n  => a + b\nadd(2, 3)"))
+	os.Stdout = stdout
+	w.Close()
+	out, _ := io.ReadAll(r)
+
+	if err != nil || v != Number(5) {
+		t.Fatalf("got %v, %v", v, err)
+	}
+	// Lookahead before the lambda must not print tokens again.
+	want := map[string]int{"'a'": 2, "')'": 2, "'=>'": 1}
+	for literal, count := range want {
+		if n := strings.Count(string(out), literal+"\n"); n != count {
+			t.Errorf("token %s is printed %d times:\n%s", literal, n, out)
+		}
+	}
+}
+
+func TestLambdaInConstructor(t *testing.T) {
+	it := NewInterpreter(Options{ObjectOriented: true, ArrowFunctions: true})
+	// Lambda body is parsed in its own function, inherited constructor
+	// call in it is not lifted.
+	_, err := it.Interpret([]byte(`
+		class A { new init() { this.a = 1; } }
+		class B extends A {
+			new init() {
+				this.b = 2;
+				this.reset = () => super.init();
+			}
+		}
+		B.init();
+	`))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,134 @@
+package eule
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// iterator walks over the value iterated by foreach loop. Tables give own
+// pairs, strings give runes, functions and tables with `next` function are
+// called until they return void.
+type iterator struct {
+	table *Table
+	keys  []String // Table keys taken at the loop start.
+	runes []rune
+	fn    Value    // Iterator function.
+	recv  receiver // Receiver of the `next` method.
+	index int
+}
+
+func newIterator(value Value) (*iterator, error) {
+	switch value := value.(type) {
+	case *Table:
+		next, recv, _ := loadMethod(value, String("next"))
+		if isCallable(next) {
+			return &iterator{fn: next, recv: recv}, nil
+		}
+		return &iterator{table: value, keys: value.sortedKeys()}, nil
+	case String:
+		return &iterator{runes: []rune(string(value))}, nil
+	case *Closure, *Native:
+		return &iterator{fn: value, recv: noReceiver}, nil
+	default:
+		return nil, fmt.Errorf("cannot iterate %s", value.typeOf())
+	}
+}
+
+// next returns key and value of the next item, ok is false when iterator
+// is exhausted. Key of iterator function item is its index. Iterator
+// function is called from the given site, vm passes nil.
+func (iter *iterator) next(
+	it *Interpreter,
+	at astNode,
+) (key, value Value, ok bool, err error) {
+	switch {
+	case iter.table != nil:
+		for iter.index < len(iter.keys) {
+			k := iter.keys[iter.index]
+			iter.index++
+			// Pairs removed by the loop body are skipped.
+			if value, ok := iter.table.Pairs[k]; ok {
+				return keyValue(k), value, true, nil
+			}
+		}
+		return nil, nil, false, nil
+	case iter.fn != nil:
+		value, err := it.callFrom(at, iter.fn, iter.recv, nil)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		if _, ok := value.(Nihil); ok {
+			return nil, nil, false, nil
+		}
+		iter.index++
+		return Number(iter.index - 1), value, true, nil
+	default:
+		if iter.index == len(iter.runes) {
+			return nil, nil, false, nil
+		}
+		iter.index++
+		return Number(iter.index - 1), String(iter.runes[iter.index-1]), true, nil
+	}
+}
+
+func isCallable(value Value) bool {
+	switch value.(type) {
+	case *Closure, *Native:
+		return true
+	default:
+		return false
+	}
+}
+
+// arrayIndex returns index of array-like key, it is non-negative integer
+// without leading zeros.
+func arrayIndex(key String) (int, bool) {
+	index, err := strconv.Atoi(string(key))
+	if err != nil || index < 0 || strconv.Itoa(index) != string(key) {
+		return 0, false
+	}
+	return index, true
+}
+
+// keyValue returns number for array-like key and the string otherwise.
+func keyValue(key String) Value {
+	if index, ok := arrayIndex(key); ok {
+		return Number(index)
+	}
+	return key
+}
+
+// sortedKeys returns array-like keys in numeric order and then other keys
+// in lexicographic order.
+func (t *Table) sortedKeys() []String {
+	keys := make([]String, 0, len(t.Pairs))
+	for key := range t.Pairs {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b String) int {
+		ai, aok := arrayIndex(a)
+		bi, bok := arrayIndex(b)
+		switch {
+		case aok && bok:
+			return ai - bi
+		case aok:
+			return -1
+		case bok:
+			return 1
+		case a < b:
+			return -1
+		case a > b:
+			return 1
+		default:
+			return 0
+		}
+	})
+	return keys
+}
+
+/* == interface ============================================================= */
+
+func (v *iterator) valueMark()     {}
+func (v *iterator) typeOf() String { return "iterator" }
+func (v *iterator) String() string { return fmt.Sprintf("<iterator %p>", v) }
@@ -0,0 +1,151 @@
+package eule
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// languageModes are options of tests in test/modes/<mode>, like in
+// scripts/test.py.
+var languageModes = map[string]Options{
+	"arrow_functions": {ArrowFunctions: true},
+	"auto_semocolons": {AutoSemicolons: true},
+	"object_oriented": {ObjectOriented: true},
+}
+
+var (
+	expectComment = regexp.MustCompile(`// expect: ?(.*)$`)
+	errorComment  = regexp.MustCompile(`// error: ?(.*)$`)
+	traceComment  = regexp.MustCompile(`// trace: ?(.*)$`)
+)
+
+// languageTest is *.eult script with its expected output, error messages
+// and trace.
+type languageTest struct {
+	source   []byte
+	expected []string
+	errors   []string
+	trace    []string
+}
+
+func parseLanguageTest(source []byte) languageTest {
+	test := languageTest{source: source}
+	for _, line := range strings.Split(string(source), "\n") {
+		if match := expectComment.FindStringSubmatch(line); match != nil {
+			test.expected = append(test.expected, match[1])
+		}
+		if match := errorComment.FindStringSubmatch(line); match != nil {
+			test.errors = append(test.errors, match[1])
+		}
+		if match := traceComment.FindStringSubmatch(line); match != nil {
+			test.trace = append(test.trace, match[1])
+		}
+	}
+	return test
+}
+
+// TestLanguage runs test/**/*.eult scripts on every backend and checks
+// their `// expect:`, `// error:` and `// trace:` comments.
+func TestLanguage(t *testing.T) {
+	root := filepath.Join("..", "test")
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".eult" {
+			return err
+		}
+		source, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		test := parseLanguageTest(source)
+		options := languageModes[filepath.Base(filepath.Dir(path))]
+		name, _ := filepath.Rel(root, path)
+
+		t.Run(filepath.ToSlash(name), func(t *testing.T) {
+			for backend, b := range backends {
+				t.Run(backend, func(t *testing.T) {
+					it := NewInterpreter(options)
+					it.SetBackend(b)
+					test.run(t, it, filepath.Base(path))
+				})
+			}
+		})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (test languageTest) run(t *testing.T, it *Interpreter, name string) {
+	output, err := captureStdout(t, func() error {
+		_, err := it.InterpretNamed(name, test.source)
+		return err
+	})
+
+	lines := []string{}
+	if output != "" {
+		lines = strings.Split(strings.TrimSuffix(output, "\n"), "\n")
+	}
+	if !slices.Equal(lines, test.expected) {
+		t.Errorf("output:\n  got  %q\n  want %q", lines, test.expected)
+	}
+
+	if err == nil {
+		if len(test.errors) != 0 {
+			t.Errorf("want errors %q, got none", test.errors)
+		}
+		return
+	}
+	if len(test.errors) == 0 {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Indented lines are source excerpts and traces.
+	var messages, trace []string
+	for _, line := range strings.Split(err.Error(), "\n") {
+		if strings.HasPrefix(line, "  at ") {
+			trace = append(trace, strings.TrimSpace(line))
+		}
+		if !strings.HasPrefix(line, " ") {
+			messages = append(messages, line)
+		}
+	}
+	for _, want := range test.errors {
+		if !slices.ContainsFunc(messages, func(message string) bool {
+			return strings.Contains(message, want)
+		}) {
+			t.Errorf("missing error %q in:\n%v", want, err)
+		}
+	}
+	// Trace is checked only when the test lists it.
+	if len(test.trace) != 0 && !slices.Equal(trace, test.trace) {
+		t.Errorf("trace:\n  got  %q\n  want %q", trace, test.trace)
+	}
+}
+
+// captureStdout returns what the function prints, scripts print to the
+// standard output.
+func captureStdout(t *testing.T, f func() error) (string, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	done := make(chan []byte)
+	go func() {
+		out, _ := io.ReadAll(r)
+		done <- out
+	}()
+
+	err = f()
+	os.Stdout = stdout
+	w.Close()
+	return string(<-done), err
+}
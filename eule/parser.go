@@ -2,7 +2,10 @@ package eule
 
 import (
 	"fmt"
+	"maps"
+	"math/big"
 	"strconv"
+	"strings"
 )
 
 type fnType int
@@ -25,23 +28,31 @@ type fnCtx struct {
 
 type loopCtx struct {
 	enclosing *loopCtx
+	label     varName
+	isSwitch  bool // Switch is target of break, but not of continue.
 }
 
 type parser struct {
 	scanner   scanner
 	cur       token
 	prev      token
-	errors    []error
+	errors    []ParseError
 	fnCtx     *fnCtx
+	label     varName                      // Label of the next loop or switch statement.
+	ctors     map[varName]map[string]empty // Constructor names of classes.
+	ctor      *ctorCtx                     // Innermost parsed constructor.
 	isCrushed bool
+	options   Options
 }
 
-func newParser(scanner scanner) *parser {
+func newParser(scanner scanner, options Options) *parser {
 	return &parser{
 		scanner:   scanner,
-		errors:    make([]error, 0),
+		errors:    make([]ParseError, 0),
 		fnCtx:     &fnCtx{fnScript, nil, nil},
+		ctors:     make(map[varName]map[string]empty),
 		isCrushed: false,
+		options:   options,
 	}
 }
 
@@ -49,7 +60,17 @@ func newParser(scanner scanner) *parser {
 
 func (p *parser) advance() {
 	p.prev = p.cur
-	p.cur = p.scanner.Scan()
+	for {
+		p.cur = p.scanner.Scan()
+		if p.cur.tokenType != tokenError {
+			return
+		}
+		// Scanner reports error message as token literal.
+		p.errors = append(p.errors, ParseError{
+			span:    span{p.scanner.file, p.cur.pos, p.cur.pos},
+			Message: p.cur.literal,
+		})
+	}
 }
 
 func (p *parser) check(type_ tokenType) bool {
@@ -72,54 +93,158 @@ func (p *parser) consume(type_ tokenType, message string) {
 }
 
 func (p *parser) consumeSemi(message string) {
-	if modeAutoSemicolons {
-		if p.match(tokenNewLine) {
+	if p.options.AutoSemicolons {
+		// Semicolon is also omitted before closing brace and at the end.
+		if p.match(tokenNewLine) || p.check(tokenRBrace) || p.check(tokenEof) {
 			return
 		}
 	}
 	p.consume(tokenSemi, message)
 }
 
+// matchWord matches identifier used as keyword in the context.
+func (p *parser) matchWord(word string) bool {
+	if p.check(tokenIdentifier) && p.cur.literal == word {
+		p.advance()
+		return true
+	}
+	return false
+}
+
 func (p *parser) consumeIdentifier(message string) *identifierLit {
 	p.consume(tokenIdentifier, message)
-	return &identifierLit{p.prev.literal}
+	return &identifierLit{
+		span:    p.tokenSpan(p.prev),
+		varName: p.prev.literal,
+	}
+}
+
+// takeLabel returns label of the statement being parsed, it has to be
+// taken before any nested statement.
+func (p *parser) takeLabel() varName {
+	label := p.label
+	p.label = ""
+	return label
+}
+
+func (p *parser) beginLoop(label varName, isSwitch bool) {
+	p.fnCtx.loopCtx = &loopCtx{
+		enclosing: p.fnCtx.loopCtx,
+		label:     label,
+		isSwitch:  isSwitch,
+	}
+}
+
+func (p *parser) endLoop() {
+	p.fnCtx.loopCtx = p.fnCtx.loopCtx.enclosing
+}
+
+// matchAssign matches '=' or compound assignment operator.
+func (p *parser) matchAssign() bool {
+	if _, ok := compoundOps[p.cur.tokenType]; ok {
+		p.advance()
+		return true
+	}
+	return p.match(tokenEq)
+}
+
+// closeChain wraps finished chain of index and call expressions with
+// optional link in chainExpr.
+func (p *parser) closeChain(expr astExpr) astExpr {
+	switch p.cur.tokenType {
+	case tokenDot, tokenQuestDot, tokenLBrack, tokenQuestLBrack, tokenLParen:
+		return expr
+	}
+	if !isOptionalChain(expr) {
+		return expr
+	}
+	return &chainExpr{span: expr.nodeSpan(), expr: expr}
+}
+
+func isOptionalChain(expr astExpr) bool {
+	for {
+		switch link := expr.(type) {
+		case *indexExpr:
+			if link.optional {
+				return true
+			}
+			expr = link.left
+		case *callExpr:
+			if link.optional {
+				return true
+			}
+			expr = link.left
+		default:
+			return false
+		}
+	}
+}
+
+// checkTarget reports error if operand of the increment operator can not
+// be assigned.
+func (p *parser) checkTarget(op token, target astExpr) {
+	switch target.(type) {
+	case *identifierLit, *indexExpr:
+	default:
+		p.errorAt(op, "invalid assignment target")
+	}
 }
 
 func (p *parser) ignoreNewLine() {
-	if modeAutoSemicolons {
+	if p.options.AutoSemicolons {
 		p.match(tokenNewLine)
 	}
 }
 
+// ParseError is syntax error, its Pos and End methods return location of
+// the invalid token.
 type ParseError struct {
-	token   token
-	message string
+	span
+	Message string
 }
 
 func (pe ParseError) Error() string {
-	return fmt.Sprintf(
-		"line %d at '%s': %s",
-		pe.token.line,
-		pe.token.literal,
-		pe.message,
-	)
+	return fmt.Sprintf("%s: %s\n%s", pe.span, pe.Message, pe.excerpt())
 }
 
+// ParseErrors lists every syntax error found in the script.
+type ParseErrors = Errors[ParseError]
+
 func (p *parser) errorAt(tk token, msg string) {
-	panic(ParseError{tk, msg})
+	panic(ParseError{p.tokenSpan(tk), msg})
+}
+
+// errorAtSpan reports error of the parsed node, parsing goes on.
+func (p *parser) errorAtSpan(at span, msg string) {
+	p.errors = append(p.errors, ParseError{at, msg})
+}
+
+func (p *parser) tokenSpan(tk token) span {
+	return span{p.scanner.file, tk.pos, tk.end()}
+}
+
+// spanFrom returns span from the start position to the end of the
+// previous token.
+func (p *parser) spanFrom(start pos) span {
+	return span{p.scanner.file, start, p.prev.end()}
 }
 
 func (p *parser) fix() {
 	defer func() { p.isCrushed = false }()
 
 	for p.cur.tokenType != tokenEof {
-		if p.prev.tokenType == tokenSemi { // TODO: what about new line?
+		if p.prev.tokenType == tokenSemi {
+			return
+		}
+		// New line ends statement like semicolon.
+		if p.options.AutoSemicolons && p.prev.tokenType == tokenNewLine {
 			return
 		}
 		switch p.cur.tokenType {
 		case tokenVariable, tokenFunction, tokenIf, tokenFor, tokenForEach,
 			tokenWhile, tokenDo, tokenContinue, tokenBreak, tokenThrow,
-			tokenTry, tokenReturn, tokenSwitch, tokenCase, tokenDefault:
+			tokenTry, tokenReturn, tokenSwitch, tokenCase, tokenDefault,
+			tokenClass:
 			return
 		}
 		p.advance()
@@ -131,26 +256,40 @@ type precedence int
 const (
 	precLowest precedence = iota
 
-	precAssign // =
-	precOr     // ||
-	precAnd    // &&
-	precEq     // == !=
-	precComp   // < > <= >=
-	precTerm   // + -
-	precFact   // * / % ~/
-	precUnary  // ! + - ~ typeof yield await ++ --
-	precCall   // . () {} []
+	precAssign   // =
+	precCond     // ?:
+	precCoalesce // ??
+	precOr       // ||
+	precAnd      // &&
+	precBitOr    // |
+	precBitXor   // ^
+	precBitAnd   // &
+	precEq       // == !=
+	precComp     // < > <= >=
+	precShift    // << >>
+	precTerm     // + -
+	precFact     // * / % ~/
+	precUnary    // ! + - ~ typeof yield await ++ --
+	precCall     // . () {} []
 
 	precHighest
 )
 
 var precedences = map[tokenType]precedence{
-	tokenEq: precAssign,
+	tokenQuest: precCond,
+
+	tokenQuestQuest: precCoalesce,
 
 	tokenPipePipe: precOr,
 
 	tokenAmperAmper: precAnd,
 
+	tokenPipe: precBitOr,
+
+	tokenCircum: precBitXor,
+
+	tokenAmper: precBitAnd,
+
 	tokenEqEq:   precEq,
 	tokenExclEq: precEq,
 
@@ -159,6 +298,9 @@ var precedences = map[tokenType]precedence{
 	tokenRAngle:   precComp,
 	tokenRAngleEq: precComp,
 
+	tokenLAngleAngle: precShift,
+	tokenRAngleAngle: precShift,
+
 	tokenPlus:  precTerm,
 	tokenMinus: precTerm,
 
@@ -166,10 +308,32 @@ var precedences = map[tokenType]precedence{
 	tokenSlash:   precFact,
 	tokenPercent: precFact,
 
-	tokenDot:    precCall,
-	tokenLParen: precCall,
-	tokenLBrack: precCall,
-	tokenLBrace: precCall,
+	tokenPlusPlus:   precCall,
+	tokenMinusMinus: precCall,
+
+	tokenDot:         precCall,
+	tokenQuestDot:    precCall,
+	tokenQuestLBrack: precCall,
+	tokenLParen:      precCall,
+	tokenLBrack:      precCall,
+	tokenLBrace:      precCall,
+}
+
+// compoundOps maps compound assignment operator to its binary operator.
+var compoundOps = map[tokenType]tokenType{
+	tokenPlusEq:        tokenPlus,
+	tokenMinusEq:       tokenMinus,
+	tokenStarEq:        tokenStar,
+	tokenSlashEq:       tokenSlash,
+	tokenPercentEq:     tokenPercent,
+	tokenPipeEq:        tokenPipe,
+	tokenAmperEq:       tokenAmper,
+	tokenCircumEq:      tokenCircum,
+	tokenLAngleAngleEq: tokenLAngleAngle,
+	tokenRAngleAngleEq: tokenRAngleAngle,
+	tokenPipePipeEq:    tokenPipePipe,
+	tokenAmperAmperEq:  tokenAmperAmper,
+	tokenQuestQuestEq:  tokenQuestQuest,
 }
 
 /* == parse ================================================================= */
@@ -178,7 +342,8 @@ func (p *parser) Parse() ([]astDecl, error) {
 	script := []astDecl{}
 	p.advance()
 
-	for !p.match(tokenEof) {
+	// New lines after closing braces separate declarations.
+	for p.ignoreNewLine(); !p.match(tokenEof); p.ignoreNewLine() {
 		decl := p.decl()
 		script = append(script, decl)
 		if p.isCrushed {
@@ -187,37 +352,52 @@ func (p *parser) Parse() ([]astDecl, error) {
 	}
 
 	if len(p.errors) != 0 {
-		return nil, p.errors[0] // TODO: collect all errors
+		return nil, ParseErrors(p.errors)
 	}
 
 	return script, nil
 }
 
 func (p *parser) decl() (decl astDecl) {
+	start := p.cur.pos
 	defer catch(func(pe ParseError) {
 		p.isCrushed = true
 		p.errors = append(p.errors, pe)
 	})
+	defer func() {
+		if decl != nil {
+			decl.setSpan(p.spanFrom(start))
+		}
+	}()
 
 	switch {
 	case p.match(tokenVariable):
 		return p.variableDecl()
 	case p.match(tokenFunction):
 		return p.functionDecl(false)
+	case p.options.ObjectOriented && p.match(tokenClass):
+		return p.classDecl()
 	case p.match(tokenAsync):
 		if p.match(tokenFunction) {
 			return p.functionDecl(true)
 		} else if p.match(tokenForEach) {
-			return &stmtDecl{p.forEachStmt(true)}
+			return &stmtDecl{stmt: p.forEachStmt(true)}
 		}
-		p.errorAt(p.cur, "ERROR")
+		p.errorAt(p.cur, "expect 'function' or 'foreach' after 'async'")
 		return
 	default:
-		return &stmtDecl{p.stmt()}
+		return &stmtDecl{stmt: p.stmt()}
 	}
 }
 
-func (p *parser) stmt() astStmt {
+func (p *parser) stmt() (stmt astStmt) {
+	start := p.cur.pos
+	defer func() {
+		if stmt != nil {
+			stmt.setSpan(p.spanFrom(start))
+		}
+	}()
+
 	switch {
 	case p.match(tokenLBrace):
 		return p.blockStmt()
@@ -231,6 +411,8 @@ func (p *parser) stmt() astStmt {
 		return p.whileStmt()
 	case p.match(tokenDo):
 		return p.doStmt()
+	case p.match(tokenSwitch):
+		return p.switchStmt()
 	case p.match(tokenContinue):
 		return p.continueStmt()
 	case p.match(tokenBreak):
@@ -242,13 +424,16 @@ func (p *parser) stmt() astStmt {
 	case p.match(tokenReturn):
 		return p.returnStmt()
 	default:
-		expr := &exprStmt{p.expr()}
-		if modeAutoSemicolons {
+		expr := &exprStmt{expr: p.expr()}
+		if label, ok := expr.expr.(*identifierLit); ok && p.match(tokenColon) {
+			return p.labeledStmt(label)
+		}
+		if p.options.AutoSemicolons {
 			if !p.match(tokenSemi) {
 				p.ignoreNewLine()
 			}
 		} else {
-			p.consumeSemi("ERROR")
+			p.consumeSemi("expect ';' after expression")
 		}
 		return expr
 	}
@@ -261,13 +446,16 @@ func (p *parser) expr() astExpr {
 func (p *parser) precExpr(prec precedence) astExpr {
 	canAssign := prec <= precAssign
 	nud := p.nud(canAssign)
+	start := nud.nodeSpan().start
 
 	for prec <= precedences[p.cur.tokenType] {
 		nud = p.led(nud, canAssign)
+		nud.setSpan(p.spanFrom(start))
+		nud = p.closeChain(nud)
 	}
 
-	if canAssign && p.match(tokenEq) {
-		p.errorAt(p.prev, "Invalid assignment target.")
+	if canAssign && p.matchAssign() {
+		p.errorAt(p.prev, "invalid assignment target")
 	}
 
 	return nud
@@ -280,7 +468,8 @@ func (p *parser) variableDecl() *variableDecl {
 
 	for {
 		vd := varDecl{}
-		vd.name = p.consumeIdentifier("ERROR").varName
+		name := p.consumeIdentifier("expect variable name")
+		vd.span, vd.name = name.span, name.varName
 		if p.match(tokenEq) {
 			vd.init = p.expr()
 		} else {
@@ -293,7 +482,7 @@ func (p *parser) variableDecl() *variableDecl {
 		}
 	}
 
-	p.consumeSemi("ERROR")
+	p.consumeSemi("expect ';' after variable declaration")
 	return decl
 }
 
@@ -305,28 +494,280 @@ func (p *parser) functionDecl(isAsync bool) *functionDecl {
 		isGen = true
 	}
 
-	decl.name = p.consumeIdentifier("ERROR").varName
+	decl.name = p.consumeIdentifier("expect function name").varName
 	var isArrow bool
 	decl.function, isArrow = p.functionLit(isAsync, isGen)
 
 	if isArrow {
-		p.consumeSemi("ERROR")
+		p.consumeSemi("expect ';' after arrow function")
 	}
 
 	return decl
 }
 
+// classFields is hidden variable of the field initializer, scripts can
+// not name it.
+const classFields varName = "<fields>"
+
+// ctorCtx is constructor being parsed.
+type ctorCtx struct {
+	fn        *fnCtx           // Context of the constructor body.
+	inherited map[string]empty // Constructor names of the parent class.
+	calls     []*callExpr      // Inherited constructor calls on `super`.
+}
+
+// classDecl lowers class to the variable holding prototype table as
+// docs/modes/oop.md describes. Methods and static fields are pairs of the
+// class table in declaration order. Constructor creates instance
+// inheriting from `this` with spread pairs of inherited constructor call,
+// if it is the first statement, and of the fields, then runs its body and
+// returns the instance. Field initializer is function created in the
+// class scope that returns table of the fields. Fields of class without
+// constructor are pairs of the class table.
+func (p *parser) classDecl() *variableDecl {
+	name := p.consumeIdentifier("expect class name")
+	var parent *identifierLit
+	if p.match(tokenExtends) {
+		parent = p.consumeIdentifier("expect superclass name after 'extends'")
+	}
+	p.consume(tokenLBrace, "expect '{' before class body")
+
+	class := &tableLit{
+		pairs: make([]tablePair, 0),
+		array: make([]astExpr, 0),
+	}
+	fields := make([]tablePair, 0)
+	ctors := make([]*functionLit, 0)
+	supers := make([]*callExpr, 0) // Lifted inherited constructor calls.
+	members := make(map[string]empty)
+
+	// Constructors of the class include inherited ones, only classes
+	// declared before have known constructors.
+	inherited, isClass := map[string]empty(nil), true
+	if parent != nil {
+		inherited, isClass = p.ctors[parent.varName]
+	}
+	names := maps.Clone(inherited)
+	if names == nil {
+		names = make(map[string]empty)
+	}
+	p.ctors[name.varName] = names
+
+	for !p.check(tokenRBrace) && !p.check(tokenEof) {
+		start := p.cur.pos
+		isStatic := p.matchWord(stringStatic)
+		isCtor := !isStatic && p.matchWord(stringNew)
+		p.consume(tokenIdentifier, "expect member name")
+		key := &stringLit{span: p.tokenSpan(p.prev), value: p.prev.literal}
+		if _, ok := members[key.value]; ok {
+			p.errorAt(p.prev, fmt.Sprintf("member '%s' already defined", key.value))
+		}
+		members[key.value] = empty{}
+
+		if p.match(tokenEq) {
+			if isCtor {
+				p.errorAt(p.prev, "expect '(' after constructor name")
+			}
+			value := p.expr()
+			p.consumeSemi("expect ';' after field")
+			if isStatic {
+				class.pairs = append(class.pairs, tablePair{key, value})
+			} else {
+				fields = append(fields, tablePair{key, value})
+			}
+			continue
+		}
+
+		var fn *functionLit
+		if isCtor {
+			var super *callExpr
+			fn, super = p.constructorLit(parent, inherited, isClass)
+			ctors = append(ctors, fn)
+			supers = append(supers, super)
+			names[key.value] = empty{}
+		} else {
+			var isArrow bool
+			fn, isArrow = p.functionLit(false, false)
+			if isArrow {
+				p.consumeSemi("expect ';' after arrow function")
+			}
+		}
+		fn.setSpan(p.spanFrom(start))
+		fn.name = key.value
+		class.pairs = append(class.pairs, tablePair{key, fn})
+	}
+	p.consume(tokenRBrace, "expect '}' after class body")
+
+	if len(ctors) == 0 {
+		class.pairs = append(class.pairs, fields...)
+		fields = nil
+	}
+	for i, ctor := range ctors {
+		ctor.body = constructorBody(ctor, supers[i], len(fields) != 0)
+	}
+
+	var init astExpr = class
+	if parent != nil {
+		init = &protoTableExpr{span: name.span, proto: parent, table: class}
+	}
+	if len(fields) != 0 {
+		init = withFields(name.span, init, fields)
+	}
+	return &variableDecl{
+		vars: []varDecl{{span: name.span, name: name.varName, init: init}},
+	}
+}
+
+// constructorLit parses constructor after its name and returns it with
+// the inherited constructor call of its first statement, nil if there is
+// no such call. Other calls of inherited constructors are errors.
+func (p *parser) constructorLit(
+	parent *identifierLit,
+	inherited map[string]empty,
+	isClass bool,
+) (
+	*functionLit,
+	*callExpr,
+) {
+	lit := &functionLit{}
+	p.consume(tokenLParen, "expect '(' before parameters")
+	lit.params = p.params()
+	p.ignoreNewLine()
+
+	enclosing := p.ctor
+	p.fnCtx = &fnCtx{fnSync, p.fnCtx, nil}
+	p.ctor = &ctorCtx{fn: p.fnCtx, inherited: inherited}
+	ctor := p.ctor
+	defer func() {
+		p.fnCtx = p.fnCtx.enclosing
+		p.ctor = enclosing
+	}()
+	p.consume(tokenLBrace, "expect '{' before constructor body")
+	lit.body = p.block()
+
+	var first *callExpr
+	if len(lit.body) != 0 {
+		first = superCall(lit.body[0])
+	}
+	if first != nil && !isClass {
+		p.errorAtSpan(first.span, fmt.Sprintf(
+			"can't call constructor of '%s', it is not class declared before",
+			parent.varName,
+		))
+	}
+	var super *callExpr
+	for _, call := range ctor.calls {
+		if call == first {
+			super = call
+			continue
+		}
+		p.errorAtSpan(call.span, "inherited constructor call must be the first statement")
+	}
+	return lit, super
+}
+
+// recordCtorCall records call of inherited constructor in the body of the
+// parsed constructor.
+func (p *parser) recordCtorCall(call *callExpr) {
+	if call.this == nil || p.ctor == nil || p.ctor.fn != p.fnCtx {
+		return
+	}
+	key, ok := call.left.(*indexExpr).index.(*stringLit)
+	if !ok {
+		return
+	}
+	if _, ok := p.ctor.inherited[key.value]; ok {
+		p.ctor.calls = append(p.ctor.calls, call)
+	}
+}
+
+// withFields returns class expression evaluated by function, which takes
+// field initializer as hidden parameter, so initializer is resolved in the
+// class scope and is shared by constructors.
+func withFields(at span, class astExpr, fields []tablePair) astExpr {
+	table := &tableLit{span: at, pairs: fields, array: make([]astExpr, 0)}
+	return &callExpr{
+		span: at,
+		left: &functionLit{
+			span:   at,
+			params: []varName{classFields},
+			body:   block{&stmtDecl{stmt: &returnStmt{span: at, value: class}}},
+		},
+		args: []astExpr{&functionLit{
+			span:   at,
+			params: []varName{},
+			body:   block{&stmtDecl{stmt: &returnStmt{span: at, value: table}}},
+		}},
+	}
+}
+
+// constructorBody wraps body of the constructor with instance creation
+// and its return, the lifted super call is the first statement of body.
+func constructorBody(ctor *functionLit, super *callExpr, hasFields bool) block {
+	this := func() *identifierLit {
+		return &identifierLit{span: ctor.span, varName: stringThis}
+	}
+	body := ctor.body
+	instance := &tableLit{
+		span:  ctor.span,
+		pairs: make([]tablePair, 0),
+		array: make([]astExpr, 0),
+	}
+	if super != nil {
+		instance.pairs = append(instance.pairs, tablePair{value: super})
+		body = body[1:]
+	}
+	if hasFields {
+		instance.pairs = append(instance.pairs, tablePair{value: &callExpr{
+			span: ctor.span,
+			left: &identifierLit{span: ctor.span, varName: classFields},
+			args: []astExpr{},
+			this: this(),
+		}})
+	}
+
+	create := &assignExpr{
+		span:  ctor.span,
+		left:  this(),
+		op:    token{tokenType: tokenEq},
+		right: &protoTableExpr{span: ctor.span, proto: this(), table: instance},
+	}
+	lowered := make(block, 0, len(body)+2)
+	lowered = append(lowered, &stmtDecl{stmt: &exprStmt{expr: create}})
+	lowered = append(lowered, body...)
+	lowered = append(lowered, &stmtDecl{stmt: &returnStmt{value: this()}})
+	return lowered
+}
+
+// superCall returns call of the declaration statement if it is method
+// call on `super`.
+func superCall(decl astDecl) *callExpr {
+	stmt, ok := decl.(*stmtDecl)
+	if !ok {
+		return nil
+	}
+	expr, ok := stmt.stmt.(*exprStmt)
+	if !ok {
+		return nil
+	}
+	call, ok := expr.expr.(*callExpr)
+	if !ok || call.this == nil {
+		return nil
+	}
+	return call
+}
+
 /* == statements ============================================================ */
 
 func (p *parser) blockStmt() *blockStmt {
-	return &blockStmt{p.block()}
+	return &blockStmt{block: p.block()}
 }
 
 func (p *parser) block() block {
 	block := make(block, 0)
-	for !p.match(tokenRBrace) {
+	for p.ignoreNewLine(); !p.match(tokenRBrace); p.ignoreNewLine() {
 		if p.match(tokenEof) {
-			p.errorAt(p.prev, "ERROR")
+			p.errorAt(p.prev, "expect '}' after block")
 		}
 		decl := p.decl()
 		block = append(block, decl)
@@ -339,19 +780,19 @@ func (p *parser) block() block {
 
 func (p *parser) ifStmt() *ifStmt {
 	stmt := &ifStmt{}
-	p.consume(tokenLParen, "ERROR")
+	p.consume(tokenLParen, "expect '(' after 'if'")
 	if p.match(tokenVariable) { // var a = b; a
 		stmt.init = p.variableDecl()
 		stmt.cond = p.expr()
 	} else {
-		stmt.init = &stmtDecl{&emptyStmt{}}
+		stmt.init = &stmtDecl{stmt: &emptyStmt{}}
 		stmt.cond = p.expr()
 		if p.match(tokenSemi) { // a = b; a
-			stmt.init = &stmtDecl{&exprStmt{stmt.cond}}
+			stmt.init = &stmtDecl{stmt: &exprStmt{expr: stmt.cond}}
 			stmt.cond = p.expr()
 		}
 	}
-	p.consume(tokenRParen, "ERROR")
+	p.consume(tokenRParen, "expect ')' after if condition")
 	p.ignoreNewLine()
 	stmt.then = p.stmt()
 	if p.match(tokenElse) {
@@ -363,108 +804,234 @@ func (p *parser) ifStmt() *ifStmt {
 }
 
 func (p *parser) forStmt() *forStmt {
-	stmt := &forStmt{}
-	p.consume(tokenLParen, "ERROR")
+	stmt := &forStmt{label: p.takeLabel()}
+	p.consume(tokenLParen, "expect '(' after 'for'")
 	if p.match(tokenVariable) {
 		stmt.init = p.variableDecl()
+	} else if p.match(tokenSemi) {
+		stmt.init = &stmtDecl{stmt: &emptyStmt{}}
 	} else {
-		stmt.init = &stmtDecl{&exprStmt{p.expr()}}
-		p.consume(tokenSemi, "ERROR")
+		stmt.init = &stmtDecl{stmt: &exprStmt{expr: p.expr()}}
+		p.consume(tokenSemi, "expect ';' after loop initializer")
 	}
 
 	if p.match(tokenSemi) {
 		stmt.cond = &emptyExpr{}
 	} else {
 		stmt.cond = p.expr()
-		p.consume(tokenSemi, "ERROR")
+		p.consume(tokenSemi, "expect ';' after loop condition")
 	}
 
 	if p.match(tokenRParen) {
 		stmt.post = &emptyExpr{}
 	} else {
 		stmt.post = p.expr()
-		p.consume(tokenRParen, "ERROR")
+		p.consume(tokenRParen, "expect ')' after for clauses")
 	}
 
-	p.consume(tokenRParen, "ERROR")
 	p.ignoreNewLine()
+	p.beginLoop(stmt.label, false)
+	defer p.endLoop()
 	stmt.loop = p.stmt()
 	return stmt
 }
 
 func (p *parser) forEachStmt(isAsync bool) *forEachStmt {
-	stmt := &forEachStmt{}
+	if isAsync {
+		p.errorAt(p.prev, "async foreach is not supported")
+	}
+	stmt := &forEachStmt{label: p.takeLabel()}
+	p.consume(tokenLParen, "expect '(' after 'foreach'")
+	p.consume(tokenVariable, "expect 'var' after '('")
+	stmt.value = p.consumeIdentifier("expect variable name").varName
+	if p.match(tokenComma) {
+		stmt.key = stmt.value
+		stmt.value = p.consumeIdentifier("expect variable name").varName
+	}
+	p.consume(tokenIn, "expect 'in' after foreach variables")
+	stmt.iter = p.expr()
+	p.consume(tokenRParen, "expect ')' after foreach clauses")
+
+	p.ignoreNewLine()
+	p.beginLoop(stmt.label, false)
+	defer p.endLoop()
+	stmt.loop = p.stmt()
 	return stmt
 }
 
 func (p *parser) whileStmt() *whileStmt {
-	stmt := &whileStmt{}
-	p.consume(tokenLParen, "ERROR")
+	stmt := &whileStmt{label: p.takeLabel()}
+	p.consume(tokenLParen, "expect '(' after 'while'")
 	stmt.cond = p.expr()
-	p.consume(tokenRParen, "ERROR")
-	p.fnCtx.loopCtx = &loopCtx{p.fnCtx.loopCtx}
-	defer func() { p.fnCtx.loopCtx = p.fnCtx.loopCtx.enclosing }()
+	p.consume(tokenRParen, "expect ')' after while condition")
+	p.beginLoop(stmt.label, false)
+	defer p.endLoop()
 	stmt.loop = p.stmt()
 	return stmt
 }
 
 func (p *parser) doStmt() *doStmt {
-	stmt := &doStmt{}
-	p.fnCtx.loopCtx = &loopCtx{p.fnCtx.loopCtx}
-	defer func() { p.fnCtx.loopCtx = p.fnCtx.loopCtx.enclosing }()
+	stmt := &doStmt{label: p.takeLabel()}
+	p.beginLoop(stmt.label, false)
+	defer p.endLoop()
 	stmt.loop = p.stmt()
-	p.consume(tokenWhile, "ERROR")
-	p.consume(tokenLParen, "ERROR")
+	p.consume(tokenWhile, "expect 'while' after do loop body")
+	p.consume(tokenLParen, "expect '(' after 'while'")
 	stmt.cond = p.expr()
-	p.consume(tokenRParen, "ERROR")
+	p.consume(tokenRParen, "expect ')' after while condition")
+	p.consumeSemi("expect ';' after do loop")
 	return stmt
 }
 
-func (p *parser) continueStmt() *continueStmt {
-	if p.fnCtx.loopCtx == nil {
-		p.errorAt(p.prev, "ERROR")
+func (p *parser) switchStmt() *switchStmt {
+	stmt := &switchStmt{cases: make([]switchCase, 0), label: p.takeLabel()}
+	p.consume(tokenLParen, "expect '(' after 'switch'")
+	stmt.value = p.expr()
+	p.consume(tokenRParen, "expect ')' after switch value")
+	p.ignoreNewLine()
+	p.consume(tokenLBrace, "expect '{' after switch value")
+	p.ignoreNewLine()
+
+	p.beginLoop(stmt.label, true)
+	defer p.endLoop()
+
+	hasDefault := false
+	for !p.match(tokenRBrace) {
+		clause := switchCase{values: make([]astExpr, 0)}
+		switch {
+		case p.match(tokenCase):
+			for {
+				clause.values = append(clause.values, p.expr())
+				if !p.match(tokenComma) {
+					break
+				}
+			}
+			p.consume(tokenColon, "expect ':' after case values")
+			p.ignoreNewLine()
+		case p.match(tokenDefault):
+			if hasDefault {
+				p.errorAt(p.prev, "multiple defaults in switch")
+			}
+			hasDefault = true
+			p.consume(tokenColon, "expect ':' after 'default'")
+			p.ignoreNewLine()
+		default:
+			p.errorAt(p.cur, "expect 'case' or 'default'")
+		}
+		clause.body = p.caseBody()
+		stmt.cases = append(stmt.cases, clause)
+	}
+	return stmt
+}
+
+// caseBody parses declarations up to the next case or the switch end.
+func (p *parser) caseBody() *blockStmt {
+	start := p.cur.pos
+	body := &blockStmt{block: make(block, 0)}
+	for !p.check(tokenCase) && !p.check(tokenDefault) &&
+		!p.check(tokenRBrace) {
+		if p.check(tokenEof) {
+			p.errorAt(p.cur, "expect '}' after switch cases")
+		}
+		body.block = append(body.block, p.decl())
+		if p.isCrushed {
+			p.fix()
+		}
 	}
+	body.setSpan(p.spanFrom(start))
+	return body
+}
+
+func (p *parser) continueStmt() *continueStmt {
 	stmt := &continueStmt{}
-	p.consumeSemi("E")
+	if p.match(tokenIdentifier) {
+		stmt.label = p.prev.literal
+		if ctx := p.findLoop(stmt.label); ctx != nil && ctx.isSwitch {
+			p.errorAt(p.prev, "label of 'continue' must name a loop")
+		}
+	} else {
+		ctx := p.fnCtx.loopCtx
+		for ctx != nil && ctx.isSwitch {
+			ctx = ctx.enclosing
+		}
+		if ctx == nil {
+			p.errorAt(p.prev, "'continue' outside loop")
+		}
+	}
+	p.consumeSemi("expect ';' after 'continue'")
 	return stmt
 }
 
 func (p *parser) breakStmt() *breakStmt {
-	if p.fnCtx.loopCtx == nil {
-		p.errorAt(p.prev, "ERROR")
-	}
 	stmt := &breakStmt{}
-	p.consumeSemi("expect new line")
+	if p.match(tokenIdentifier) {
+		stmt.label = p.prev.literal
+		p.findLoop(stmt.label)
+	} else if p.fnCtx.loopCtx == nil {
+		p.errorAt(p.prev, "'break' outside loop or switch")
+	}
+	p.consumeSemi("expect ';' after 'break'")
 	return stmt
 }
 
+// labeledStmt parses loop or switch after its label.
+func (p *parser) labeledStmt(label *identifierLit) astStmt {
+	for ctx := p.fnCtx.loopCtx; ctx != nil; ctx = ctx.enclosing {
+		if ctx.label == label.varName {
+			msg := "label '" + label.varName + "' already used"
+			panic(ParseError{label.span, msg})
+		}
+	}
+	p.ignoreNewLine()
+	switch p.cur.tokenType {
+	case tokenFor, tokenForEach, tokenWhile, tokenDo, tokenSwitch:
+		p.label = label.varName
+		return p.stmt()
+	default:
+		p.errorAt(p.cur, "expect loop or switch after label")
+		return nil
+	}
+}
+
+// findLoop returns enclosing loop or switch with the label, label is the
+// previous token.
+func (p *parser) findLoop(label varName) *loopCtx {
+	for ctx := p.fnCtx.loopCtx; ctx != nil; ctx = ctx.enclosing {
+		if ctx.label == label {
+			return ctx
+		}
+	}
+	p.errorAt(p.prev, "undefined label '"+label+"'")
+	return nil
+}
+
 func (p *parser) throwStmt() *throwStmt {
-	stmt := &throwStmt{p.expr()}
-	p.consumeSemi("expect new line")
+	stmt := &throwStmt{throw: p.expr()}
+	p.consumeSemi("expect ';' after thrown value")
 	return stmt
 }
 
 func (p *parser) tryStmt() *tryStmt {
 	stmt := &tryStmt{}
-	p.consume(tokenLBrace, "ERROR")
+	p.consume(tokenLBrace, "expect '{' after 'try'")
 	stmt.try = p.blockStmt()
 
 	if p.match(tokenCatch) {
 		if p.match(tokenLParen) {
-			stmt.as = p.consumeIdentifier("ERROR").varName
-			p.consume(tokenRParen, "ERROR")
+			stmt.as = p.consumeIdentifier("expect catch variable name").varName
+			p.consume(tokenRParen, "expect ')' after catch variable")
 		}
-		p.consume(tokenLBrace, "ERROR")
+		p.consume(tokenLBrace, "expect '{' after 'catch'")
 		stmt.catch = p.blockStmt()
 	}
 
 	if p.match(tokenFinally) {
-		p.consume(tokenLBrace, "ERROR")
+		p.consume(tokenLBrace, "expect '{' after 'finally'")
 		stmt.finally = p.blockStmt()
 	}
 
 	if stmt.catch == nil && stmt.finally == nil {
-		p.errorAt(p.cur, "expect 'except' or 'finally'")
+		p.errorAt(p.cur, "expect 'catch' or 'finally'")
 	}
 
 	return stmt
@@ -474,35 +1041,56 @@ func (p *parser) returnStmt() *returnStmt {
 	if p.fnCtx.fnType == fnScript {
 		p.errorAt(p.prev, "'return' outside function")
 	}
-	stmt := &returnStmt{p.expr()}
-	p.consumeSemi("expect new line")
+	if p.ctor != nil && p.ctor.fn == p.fnCtx {
+		// Constructor returns the instance.
+		at := p.tokenSpan(p.prev)
+		if !p.check(tokenSemi) && !(p.options.AutoSemicolons &&
+			(p.check(tokenNewLine) || p.check(tokenRBrace) || p.check(tokenEof))) {
+			p.errorAt(p.cur, "can't return value from constructor")
+		}
+		p.consumeSemi("expect ';' after 'return'")
+		return &returnStmt{value: &identifierLit{span: at, varName: stringThis}}
+	}
+	stmt := &returnStmt{value: p.expr()}
+	p.consumeSemi("expect ';' after return value")
 	return stmt
 }
 
 /* == expressions =========================================================== */
 
-func (p *parser) nud(canAssign bool) astExpr {
+func (p *parser) nud(canAssign bool) (expr astExpr) {
+	start := p.cur.pos
+	defer func() {
+		if expr != nil {
+			expr.setSpan(p.spanFrom(start))
+		}
+	}()
+
 	switch {
 	case p.match(tokenIdentifier):
-		ident := &identifierLit{p.prev.literal}
-		if canAssign && p.match(tokenEq) {
-			return &assignExpr{ident, p.expr()}
+		ident := &identifierLit{
+			span:    p.tokenSpan(p.prev),
+			varName: p.prev.literal,
+		}
+		if canAssign && p.matchAssign() {
+			op := p.prev
+			return &assignExpr{left: ident, op: op, right: p.expr()}
 		}
 		return ident
 
 	case p.match(tokenNihil):
 		return &nihilLit{}
 	case p.match(tokenTrue):
-		return &booleanLit{true}
+		return &booleanLit{value: true}
 	case p.match(tokenFalse):
-		return &booleanLit{false}
+		return &booleanLit{value: false}
 	case p.match(tokenInteger):
 		return parseInteger(p.prev.literal)
 	case p.match(tokenFloat):
 		return parseFloat(p.prev.literal)
 	case p.match(tokenString):
 		return &stringLit{
-			p.prev.literal[1 : len(p.prev.literal)-2],
+			value: p.prev.literal[1 : len(p.prev.literal)-1],
 		}
 	case p.match(tokenLBrace):
 		return p.tableLit()
@@ -518,37 +1106,82 @@ func (p *parser) nud(canAssign bool) astExpr {
 		return fl
 
 	case p.match(tokenLParen):
-		p.advance()
+		if p.options.ArrowFunctions && p.isLambda() {
+			return p.lambdaLit()
+		}
 		group := p.expr()
-		p.consume(tokenRParen, "ERROR")
+		p.consume(tokenRParen, "expect ')' after expression")
 		return group
+	case p.match(tokenTypeOf), p.match(tokenYield):
+		p.errorAt(p.prev, fmt.Sprintf("'%s' is not supported", p.prev.literal))
+		return nil
 	case p.match(tokenPlus), p.match(tokenMinus), p.match(tokenExcl),
-		p.match(tokenTypeOf), p.match(tokenYield),
-		p.match(tokenPlusPlus), p.match(tokenMinusMinus):
+		p.match(tokenTilde), p.match(tokenPlusPlus), p.match(tokenMinusMinus):
 		op := p.prev
 		right := p.precExpr(precUnary)
-		return &prefixExpr{op, right}
+		if op.tokenType == tokenPlusPlus || op.tokenType == tokenMinusMinus {
+			p.checkTarget(op, right)
+		}
+		return &prefixExpr{op: op, right: right}
 	default:
-		p.errorAt(p.cur, "ERROR")
+		p.advance() // Skip unexpected token, so recovery makes progress.
+		p.errorAt(p.prev, "expect expression")
 		return nil
 	}
 }
 
+// superThis returns `this` identifier for the super method callee, super
+// methods are called on the current receiver.
+func superThis(callee astExpr) *identifierLit {
+	index, ok := callee.(*indexExpr)
+	if !ok {
+		return nil
+	}
+	if name, ok := index.left.(*identifierLit); ok && name.varName == stringSuper {
+		return &identifierLit{span: name.span, varName: stringThis}
+	}
+	return nil
+}
+
 func (p *parser) led(nud astExpr, canAssign bool) astExpr {
 	var to astExpr
 	switch {
 	case p.match(tokenDot):
-		p.consume(tokenIdentifier, "ERROR")
+		p.consume(tokenIdentifier, "expect property name after '.'")
 		to = &indexExpr{
-			left:  nud,
-			index: &stringLit{p.prev.literal},
+			left: nud,
+			index: &stringLit{
+				span:  p.tokenSpan(p.prev),
+				value: p.prev.literal,
+			},
+		}
+		goto assign
+	case p.match(tokenQuestDot):
+		if p.match(tokenLParen) {
+			return &callExpr{
+				left:     nud,
+				args:     p.args(),
+				optional: true,
+			}
+		}
+		p.consume(tokenIdentifier, "expect property name after '?.'")
+		to = &indexExpr{
+			left: nud,
+			index: &stringLit{
+				span:  p.tokenSpan(p.prev),
+				value: p.prev.literal,
+			},
+			optional: true,
 		}
 		goto assign
 	case p.match(tokenLParen):
-		return &callExpr{
+		call := &callExpr{
 			left: nud,
 			args: p.args(),
+			this: superThis(nud),
 		}
+		p.recordCtorCall(call)
+		return call
 	case p.match(tokenLBrace):
 		return &protoTableExpr{
 			proto: nud,
@@ -556,46 +1189,104 @@ func (p *parser) led(nud astExpr, canAssign bool) astExpr {
 		}
 	case p.match(tokenLBrack):
 		index := p.expr()
-		p.consume(tokenRBrack, "ERROR")
+		p.consume(tokenRBrack, "expect ']' after index")
 		to = &indexExpr{
 			left:  nud,
 			index: index,
 		}
 		goto assign
+	case p.match(tokenQuestLBrack):
+		index := p.expr()
+		p.consume(tokenRBrack, "expect ']' after index")
+		to = &indexExpr{
+			left:     nud,
+			index:    index,
+			optional: true,
+		}
+		goto assign
 
+	case p.match(tokenPlusPlus), p.match(tokenMinusMinus):
+		p.checkTarget(p.prev, nud)
+		return &postfixExpr{left: nud, op: p.prev}
+	case p.match(tokenQuest):
+		expr := &condExpr{cond: nud, then: p.expr()}
+		p.consume(tokenColon, "expect ':' after then branch")
+		expr.else_ = p.precExpr(precCond) // Right associative.
+		return expr
+	case p.match(tokenAmperAmper), p.match(tokenPipePipe),
+		p.match(tokenQuestQuest):
+		op := p.prev
+		return &logicalExpr{
+			left:  nud,
+			op:    op,
+			right: p.precExpr(precedences[op.tokenType] + 1),
+		}
 	case p.match(tokenPlus), p.match(tokenMinus),
 		p.match(tokenStar), p.match(tokenSlash), p.match(tokenPercent),
-		p.match(tokenPipe), p.match(tokenAmper), p.match(tokenCircum):
+		p.match(tokenPipe), p.match(tokenAmper), p.match(tokenCircum),
+		p.match(tokenLAngleAngle), p.match(tokenRAngleAngle),
+		p.match(tokenEqEq), p.match(tokenExclEq),
+		p.match(tokenLAngle), p.match(tokenLAngleEq),
+		p.match(tokenRAngle), p.match(tokenRAngleEq):
 		op := p.prev
 		return &infixExpr{
 			left:  nud,
 			op:    op,
-			right: p.precExpr(precedences[op.tokenType]),
+			right: p.precExpr(precedences[op.tokenType] + 1), // Left associative.
 		}
 	default:
 		panic(unreachable)
 	}
 
 assign:
-	if canAssign && p.match(tokenEq) {
-		return &assignExpr{to, p.expr()}
+	to.setSpan(p.spanFrom(nud.nodeSpan().start))
+	// Optional chain can not be assigned.
+	if canAssign && !isOptionalChain(to) && p.matchAssign() {
+		op := p.prev
+		right := p.expr()
+		if key, ok := to.(*indexExpr).index.(*stringLit); ok {
+			nameFunction(right, key.value)
+		}
+		return &assignExpr{left: to, op: op, right: right}
 	}
 	return to
 }
 
+// nameFunction names anonymous function after the key it is stored by, so
+// traces identify methods.
+func nameFunction(value astExpr, name string) {
+	if fn, ok := value.(*functionLit); ok && fn.name == "" {
+		fn.name = name
+	}
+}
+
+// parseInteger parses checked by scanner literal, integers that do not fit
+// in int64 are rounded to float.
 func parseInteger(literal string) astExpr {
-	float, _ := strconv.ParseFloat(literal, 64)
-	return &floatLit{float}
+	digits := strings.ReplaceAll(literal, "_", "")
+	base := 10
+	if len(digits) > 2 && digits[0] == '0' {
+		if b, ok := intBases[lowerChar(digits[1])]; ok {
+			base = b
+			digits = digits[2:]
+		}
+	}
+	if value, err := strconv.ParseInt(digits, base, 64); err == nil {
+		return &integerLit{value: value}
+	}
+	value, _ := new(big.Int).SetString(digits, base)
+	float, _ := new(big.Float).SetInt(value).Float64()
+	return &floatLit{value: float}
 }
 
 func parseFloat(literal string) astExpr {
 	float, _ := strconv.ParseFloat(literal, 64)
-	return &floatLit{float}
+	return &floatLit{value: float}
 }
 
 func (p *parser) tableLit() *tableLit {
 	lit := &tableLit{
-		pairs: make(map[astExpr]astExpr),
+		pairs: make([]tablePair, 0),
 		array: make([]astExpr, 0),
 	}
 	if p.match(tokenRBrace) {
@@ -606,19 +1297,24 @@ func (p *parser) tableLit() *tableLit {
 		switch {
 		case p.match(tokenLBrack): // [key]: val
 			key = p.expr()
-			p.consume(tokenRBrack, "expect ']'")
-			p.consume(tokenColon, "expect ':'")
+			p.consume(tokenRBrack, "expect ']' after table key")
+			p.consume(tokenColon, "expect ':' after table key")
 			val = p.expr()
 		case p.match(tokenColon): // :keyval
-			val = p.consumeIdentifier("ERROR")
-			key = &stringLit{p.prev.literal}
+			val = p.consumeIdentifier("expect identifier after ':'")
+			key = &stringLit{value: p.prev.literal}
+		case p.match(tokenDotDotDot): // ...val
+			val = p.expr()
 		default: // prop: val
-			p.consume(tokenIdentifier, "ERROR")
-			key = &stringLit{p.prev.literal}
-			p.consume(tokenColon, "ERROR")
+			p.consume(tokenIdentifier, "expect property name")
+			key = &stringLit{value: p.prev.literal}
+			p.consume(tokenColon, "expect ':' after property name")
 			val = p.expr()
 		}
-		lit.pairs[key] = val
+		if key, ok := key.(*stringLit); ok {
+			nameFunction(val, key.value)
+		}
+		lit.pairs = append(lit.pairs, tablePair{key, val})
 		if !p.match(tokenComma) {
 			break
 		}
@@ -626,13 +1322,13 @@ func (p *parser) tableLit() *tableLit {
 			break
 		}
 	}
-	p.consume(tokenRBrace, "expect '}'")
+	p.consume(tokenRBrace, "expect '}' after table pairs")
 	return lit
 }
 
 func (p *parser) arrayLit() *tableLit {
 	lit := &tableLit{
-		pairs: make(map[astExpr]astExpr, 0),
+		pairs: make([]tablePair, 0),
 		array: make([]astExpr, 0),
 	}
 	if p.match(tokenRBrack) {
@@ -647,7 +1343,7 @@ func (p *parser) arrayLit() *tableLit {
 			break
 		}
 	}
-	p.consume(tokenRBrack, "expect ']'")
+	p.consume(tokenRBrack, "expect ']' after array elements")
 	return lit
 }
 
@@ -658,40 +1354,82 @@ func (p *parser) functionLit(
 	lit *functionLit,
 	isArrow bool,
 ) {
-	p.consume(tokenLParen, "ERROR")
+	lit = &functionLit{}
+	p.consume(tokenLParen, "expect '(' before parameters")
 	lit.params = p.params()
 	p.ignoreNewLine()
-	if modeArrowFunctions && p.match(tokenArrow) {
-		isArrow = true
-		lit.body = block{&stmtDecl{&returnStmt{p.expr()}}}
+	if isAsync {
+		if isGen {
+			p.fnCtx = &fnCtx{fnAsyncGen, p.fnCtx, nil}
+		} else {
+			p.fnCtx = &fnCtx{fnAsync, p.fnCtx, nil}
+		}
 	} else {
-		if isAsync {
-			if isGen {
-				p.fnCtx = &fnCtx{fnAsyncGen, p.fnCtx, nil}
-			} else {
-				p.fnCtx = &fnCtx{fnAsync, p.fnCtx, nil}
-			}
+		if isGen {
+			p.fnCtx = &fnCtx{fnSyncGen, p.fnCtx, nil}
 		} else {
-			if isGen {
-				p.fnCtx = &fnCtx{fnSyncGen, p.fnCtx, nil}
-			} else {
-				p.fnCtx = &fnCtx{fnSync, p.fnCtx, nil}
-			}
+			p.fnCtx = &fnCtx{fnSync, p.fnCtx, nil}
 		}
-		defer func() { p.fnCtx = p.fnCtx.enclosing }()
-		p.consume(tokenLBrace, "ERROR")
+	}
+	defer func() { p.fnCtx = p.fnCtx.enclosing }()
+	if p.options.ArrowFunctions && p.match(tokenArrow) {
+		isArrow = true
+		lit.body = p.arrowBody()
+	} else {
+		p.consume(tokenLBrace, "expect '{' before function body")
 		lit.body = p.block()
 	}
 	return
 }
 
+// isLambda looks ahead after '(' for parameters followed by '=>'.
+func (p *parser) isLambda() bool {
+	// Scanner is copied, so parser state is kept. Tokens are printed once
+	// when parser scans them.
+	scanner := p.scanner
+	scanner.options.PrintTokens = false
+	tk := p.cur
+	for tk.tokenType != tokenRParen {
+		if tk.tokenType != tokenIdentifier {
+			return false
+		}
+		if tk = scanner.Scan(); tk.tokenType == tokenComma {
+			tk = scanner.Scan()
+		} else if tk.tokenType != tokenRParen {
+			return false
+		}
+	}
+	tk = scanner.Scan()
+	if p.options.AutoSemicolons && tk.tokenType == tokenNewLine {
+		tk = scanner.Scan() // See ignoreNewLine.
+	}
+	return tk.tokenType == tokenArrow
+}
+
+// lambdaLit parses `(params) => value` function after '('.
+func (p *parser) lambdaLit() *functionLit {
+	lit := &functionLit{params: p.params()}
+	p.ignoreNewLine()
+	p.consume(tokenArrow, "expect '=>' after parameters")
+	p.fnCtx = &fnCtx{fnSync, p.fnCtx, nil}
+	defer func() { p.fnCtx = p.fnCtx.enclosing }()
+	lit.body = p.arrowBody()
+	return lit
+}
+
+// arrowBody returns function body that returns the expression.
+func (p *parser) arrowBody() block {
+	return block{&stmtDecl{stmt: &returnStmt{value: p.expr()}}}
+}
+
 func (p *parser) params() []varName {
 	params := []varName{}
 	if p.match(tokenRParen) {
 		return params
 	}
 	for {
-		params = append(params, p.consumeIdentifier("ERROR").varName)
+		param := p.consumeIdentifier("expect parameter name")
+		params = append(params, param.varName)
 		if !p.match(tokenComma) {
 			break
 		}
@@ -699,7 +1437,7 @@ func (p *parser) params() []varName {
 			break
 		}
 	}
-	p.consume(tokenRParen, "ERROR")
+	p.consume(tokenRParen, "expect ')' after parameters")
 	return params
 }
 
@@ -717,6 +1455,6 @@ func (p *parser) args() []astExpr {
 			break
 		}
 	}
-	p.consume(tokenRParen, "ERROR")
+	p.consume(tokenRParen, "expect ')' after arguments")
 	return args
 }
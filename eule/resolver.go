@@ -0,0 +1,333 @@
+package eule
+
+import "fmt"
+
+// ResolveError is invalid use of variable, its Pos and End methods return
+// location of the name.
+type ResolveError struct {
+	span
+	Message string
+}
+
+func (re ResolveError) Error() string {
+	return fmt.Sprintf("%s: %s\n%s", re.span, re.Message, re.excerpt())
+}
+
+// ResolveErrors lists every resolve error found in the script.
+type ResolveErrors = Errors[ResolveError]
+
+type scope struct {
+	slots   map[varName]int
+	pending map[varName]empty // Declared, but initializer is not resolved yet.
+	hoisted map[varName]int   // Declarations of the block not reached yet.
+}
+
+func newScope() *scope {
+	return &scope{
+		slots:   make(map[varName]int),
+		pending: make(map[varName]empty),
+		hoisted: make(map[varName]int),
+	}
+}
+
+// resolver binds every identifier to the scope distance and slot index
+// that interpreter uses to access variable. Bottom scope is script scope,
+// its variables are globals and accessed by name.
+type resolver struct {
+	scopes   []*scope
+	function int // First scope of the resolved function.
+	errors   []ResolveError
+}
+
+func newResolver() *resolver {
+	return &resolver{
+		scopes: []*scope{newScope()},
+		errors: make([]ResolveError, 0),
+	}
+}
+
+func (r *resolver) Resolve(script []astDecl) error {
+	for _, decl := range script {
+		r.resolve(decl)
+	}
+
+	if len(r.errors) != 0 {
+		return ResolveErrors(r.errors)
+	}
+
+	return nil
+}
+
+func (r *resolver) errorAt(at span, msg string) {
+	r.errors = append(r.errors, ResolveError{at, msg})
+}
+
+/* == scopes ================================================================ */
+
+func (r *resolver) beginScope() {
+	r.scopes = append(r.scopes, newScope())
+}
+
+// endScope returns size of the ended scope.
+func (r *resolver) endScope() int {
+	size := len(r.scopes[len(r.scopes)-1].slots)
+	r.scopes = r.scopes[:len(r.scopes)-1]
+	return size
+}
+
+func (r *resolver) isGlobal() bool {
+	return len(r.scopes) == 1
+}
+
+// declare returns slot of the declared variable, -1 for globals.
+func (r *resolver) declare(name varName, at span) int {
+	scope := r.scopes[len(r.scopes)-1]
+	if scope.hoisted[name] > 0 {
+		// Slot is taken when block is entered.
+		scope.hoisted[name]--
+		scope.pending[name] = empty{}
+		return scope.slots[name]
+	}
+	if _, ok := scope.slots[name]; ok {
+		r.errorAt(at, "variable already declared in this scope")
+	}
+
+	slot := len(scope.slots)
+	scope.slots[name] = slot
+	scope.pending[name] = empty{}
+
+	if r.isGlobal() {
+		return -1
+	}
+	return slot
+}
+
+func (r *resolver) define(name varName) {
+	delete(r.scopes[len(r.scopes)-1].pending, name)
+}
+
+// hoist declares variables and functions of the local block before its
+// statements are resolved, so closures can refer to later declarations.
+func (r *resolver) hoist(block block) {
+	for _, decl := range block {
+		switch decl := decl.(type) {
+		case *variableDecl:
+			for _, v := range decl.vars {
+				r.hoistName(v.name, v.span)
+			}
+		case *functionDecl:
+			r.hoistName(decl.name, decl.span)
+		}
+	}
+}
+
+func (r *resolver) hoistName(name varName, at span) {
+	scope := r.scopes[len(r.scopes)-1]
+	if _, ok := scope.slots[name]; ok {
+		r.errorAt(at, "variable already declared in this scope")
+	} else {
+		scope.slots[name] = len(scope.slots)
+	}
+	scope.hoisted[name]++
+}
+
+func (r *resolver) resolveName(node *identifierLit) {
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		scope := r.scopes[i]
+		slot, ok := scope.slots[node.varName]
+		if !ok {
+			continue
+		}
+
+		if _, ok := scope.pending[node.varName]; ok && i == len(r.scopes)-1 {
+			r.errorAt(node.span, "can't read variable in its own initializer")
+		}
+		// Closures may refer to later declarations, code of the same
+		// function runs before them.
+		if scope.hoisted[node.varName] > 0 && i >= r.function {
+			r.errorAt(node.span, "can't read variable before its declaration")
+		}
+
+		if i == 0 {
+			break
+		}
+		node.depth = len(r.scopes) - 1 - i
+		node.slot = slot
+		return
+	}
+
+	// Not found variables are late bound globals.
+	node.depth = -1
+	node.slot = -1
+}
+
+/* == resolve =============================================================== */
+
+func (r *resolver) resolve(node astNode) {
+	switch node := node.(type) {
+	/* == declarations ====================================================== */
+	case *errorDecl:
+		panic(unreachable)
+	case *variableDecl:
+		for i := range node.vars {
+			decl := &node.vars[i]
+			decl.slot = r.declare(decl.name, decl.span)
+			r.resolve(decl.init)
+			r.define(decl.name)
+		}
+	case *functionDecl:
+		node.slot = r.declare(node.name, node.span)
+		r.define(node.name) // Allows recursion.
+		r.resolve(node.function)
+	case *stmtDecl:
+		r.resolve(node.stmt)
+	/* == statements ======================================================== */
+	case *emptyStmt:
+	case *blockStmt:
+		r.beginScope()
+		r.resolveBlock(node.block)
+		node.slots = r.endScope()
+	case *ifStmt:
+		r.beginScope()
+		r.resolve(node.init)
+		r.resolve(node.cond)
+		r.resolve(node.then)
+		r.resolve(node.else_)
+		node.slots = r.endScope()
+	case *forStmt:
+		r.beginScope()
+		r.resolve(node.init)
+		r.resolve(node.cond)
+		r.resolve(node.post)
+		r.resolve(node.loop)
+		node.slots = r.endScope()
+	case *forEachStmt:
+		r.resolve(node.iter)
+		r.beginScope()
+		if node.key != "" {
+			r.declare(node.key, node.span)
+			r.define(node.key)
+		}
+		r.declare(node.value, node.span)
+		r.define(node.value)
+		r.resolve(node.loop)
+		node.slots = r.endScope()
+	case *whileStmt:
+		r.resolve(node.cond)
+		r.resolve(node.loop)
+	case *doStmt:
+		r.resolve(node.loop)
+		r.resolve(node.cond)
+	case *switchStmt:
+		r.resolve(node.value)
+		for _, clause := range node.cases {
+			for _, value := range clause.values {
+				r.resolve(value)
+			}
+			r.resolve(clause.body)
+		}
+	case *continueStmt:
+	case *breakStmt:
+	case *throwStmt:
+		r.resolve(node.throw)
+	case *tryStmt:
+		r.resolve(node.try)
+		if node.catch != nil {
+			r.beginScope()
+			if node.as != "" {
+				r.declare(node.as, node.span)
+				r.define(node.as)
+			}
+			r.resolve(node.catch)
+			r.endScope()
+		}
+		if node.finally != nil {
+			r.resolve(node.finally)
+		}
+	case *returnStmt:
+		r.resolve(node.value)
+	case *exprStmt:
+		r.resolve(node.expr)
+	/* == expressions ======================================================= */
+	case *emptyExpr:
+	case *assignExpr:
+		r.resolve(node.right)
+		r.resolve(node.left)
+	case *prefixExpr:
+		r.resolve(node.right)
+	case *infixExpr:
+		r.resolve(node.left)
+		r.resolve(node.right)
+	case *logicalExpr:
+		r.resolve(node.left)
+		r.resolve(node.right)
+	case *condExpr:
+		r.resolve(node.cond)
+		r.resolve(node.then)
+		r.resolve(node.else_)
+	case *postfixExpr:
+		r.resolve(node.left)
+	case *callExpr:
+		if node.this != nil {
+			r.resolve(node.this)
+		}
+		r.resolve(node.left)
+		for _, arg := range node.args {
+			r.resolve(arg)
+		}
+	case *indexExpr:
+		r.resolve(node.left)
+		r.resolve(node.index)
+	case *chainExpr:
+		r.resolve(node.expr)
+	case *protoTableExpr:
+		r.resolve(node.proto)
+		r.resolve(node.table)
+
+	case *identifierLit:
+		r.resolveName(node)
+	case *nihilLit:
+	case *booleanLit:
+	case *integerLit:
+	case *floatLit:
+	case *stringLit:
+	case *tableLit:
+		for _, pair := range node.pairs {
+			if pair.key != nil {
+				r.resolve(pair.key)
+			}
+			r.resolve(pair.value)
+		}
+		for _, v := range node.array {
+			r.resolve(v)
+		}
+	case *functionLit:
+		r.beginScope()
+		enclosing := r.function
+		r.function = len(r.scopes) - 1
+		for _, param := range node.params {
+			r.declare(param, node.span)
+			r.define(param)
+		}
+		// Receiver takes slots after params.
+		for _, name := range []varName{stringThis, stringSuper} {
+			r.declare(name, node.span)
+			r.define(name)
+		}
+		r.resolveBlock(node.body)
+		node.slots = r.endScope()
+		r.function = enclosing
+
+	default:
+		panic(unreachable)
+	}
+}
+
+func (r *resolver) resolveBlock(block block) {
+	if !r.isGlobal() {
+		r.hoist(block)
+	}
+	for _, decl := range block {
+		r.resolve(decl)
+	}
+}
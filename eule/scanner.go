@@ -4,32 +4,28 @@ import (
 	"fmt"
 )
 
-func init() {
-	if modeArrowFunctions {
-		dual[dualSymbol{'=', '>'}] = tokenArrow
-	}
-	if modeObjectOriented {
-		keywords["class"] = tokenClass
-		keywords["extends"] = tokenExtends
-	}
-}
-
 const eofByte = 0
 
 type scanner struct {
-	source []byte
-	cursor int
-	start  int
-	line   int
-	inl    bool // Insert new line token.
+	file      *sourceFile
+	source    []byte
+	cursor    int
+	start     int
+	line      int
+	lineStart int  // Offset of the current line.
+	inl       bool // Insert new line token.
+	options   Options
 }
 
-func newScanner(source []byte) scanner {
+func newScanner(file *sourceFile, options Options) scanner {
 	return scanner{
-		source: source,
-		cursor: 0,
-		line:   1,
-		inl:    false,
+		file:      file,
+		source:    file.text,
+		cursor:    0,
+		line:      1,
+		lineStart: 0,
+		inl:       false,
+		options:   options,
 	}
 }
 
@@ -40,7 +36,7 @@ begin:
 
 	s.start = s.cursor
 
-	if modeAutoSemicolons {
+	if s.options.AutoSemicolons {
 		if s.inl && line < s.line {
 			return s.makeToken(tokenNewLine)
 		}
@@ -78,14 +74,14 @@ begin:
 		s.advance()
 		s.advance()
 		return s.makeToken(t)
-	} else if t, ok := dual[dualSymbol{char, s.current()}]; ok {
+	} else if t, ok := dual[dualSymbol{char, s.current()}]; ok && s.allows(t) {
 		s.advance()
 		return s.makeToken(t)
 	} else if t, ok := mono[char]; ok {
 		return s.makeToken(t)
 	}
 
-	return s.errorToken("ERROR 1")
+	return s.errorToken("unexpected character")
 }
 
 func (s *scanner) isAtEnd() bool {
@@ -116,19 +112,32 @@ func (s *scanner) makeToken(t tokenType) token {
 	_, s.inl = inlAfter[t]
 
 	literal := string(s.source[s.start:s.cursor])
-	tk := token{t, s.line, literal}
+	tk := token{t, s.startPos(), literal}
 
-	if debugPrintTokens {
+	if s.options.PrintTokens {
 		fmt.Println(tk)
 	}
 
 	return tk
 }
 
+func (s *scanner) startPos() pos {
+	return pos{
+		line:   s.line,
+		col:    s.start - s.lineStart + 1,
+		offset: s.start,
+	}
+}
+
+func (s *scanner) newLine() {
+	s.line++
+	s.lineStart = s.cursor + 1
+}
+
 func (s *scanner) errorToken(message string) token {
 	return token{
 		tokenType: tokenError,
-		line:      s.line,
+		pos:       s.startPos(),
 		literal:   message,
 	}
 }
@@ -137,7 +146,7 @@ func (s *scanner) skipWhite() {
 	for {
 		switch char := s.current(); char {
 		case '\n':
-			s.line++
+			s.newLine()
 			fallthrough
 		case ' ', '\r', '\t':
 			s.advance()
@@ -154,28 +163,42 @@ func (s *scanner) skipLineComment() {
 }
 
 func (s *scanner) skipMultiLineComment() (token, bool) {
-	for (s.current() != '*' && s.peek() != '/') ||
-		!s.isAtEnd() {
+	s.advance() // Read opening '*'.
+	for !(s.current() == '*' && s.peek() == '/') && !s.isAtEnd() {
 		if s.current() == '\n' {
-			s.line++
+			s.newLine()
 		}
 		s.advance()
 	}
 
 	if s.isAtEnd() {
-		return s.errorToken("ERROR 2"), true
+		return s.errorToken("unterminated comment"), true
 	}
 
+	s.advance() // Read closing '*/'.
+	s.advance()
 	return token{}, false
 }
 
 func (s *scanner) identifierType() tokenType {
-	if t, ok := keywords[string(s.source[s.start:s.cursor])]; ok {
+	if t, ok := keywords[string(s.source[s.start:s.cursor])]; ok && s.allows(t) {
 		return t
 	}
 	return tokenIdentifier
 }
 
+// allows reports whether token is enabled by the language modes.
+func (s *scanner) allows(t tokenType) bool {
+	switch t {
+	case tokenArrow:
+		return s.options.ArrowFunctions
+	case tokenClass, tokenExtends:
+		return s.options.ObjectOriented
+	default:
+		return true
+	}
+}
+
 func (s *scanner) identifier() token {
 	for isAlpha(s.current()) || isDigit(s.current(), 10) {
 		s.advance()
@@ -194,12 +217,15 @@ func (s *scanner) number(firstChar byte) token {
 		if b, ok := intBases[lowerChar(s.current())]; ok {
 			base = b
 			s.advance()
+			if !isDigit(s.current(), base) {
+				return s.errorToken("expect digits after number prefix")
+			}
 		}
 	}
 
 	// readDigits returns false if literal ends with underscore.
-	readDigits := func() bool {
-		allowUnderscore := false
+	readDigits := func(afterDigit bool) bool {
+		allowUnderscore := afterDigit
 		// To avoid return false when no one digit is readed.
 		notReaded := true
 		for isDigit(s.current(), base) ||
@@ -213,21 +239,22 @@ func (s *scanner) number(firstChar byte) token {
 
 	numberType := tokenInteger
 
-	// Read integer.
-	if !readDigits() { // Ends with underscore or double underscore.
-		return s.errorToken("ERROR")
-	} else if isAlpha(s.current()) { // '3abc' not allowed.
-		return s.errorToken("ERROR")
+	// Read integer, first decimal digit is already read.
+	if !readDigits(base == 10) { // Ends with underscore or double underscore.
+		return s.errorToken("invalid underscore in number")
+	} else if isAlpha(s.current()) || isDigit(s.current(), 10) {
+		// '3abc' and '0b12' not allowed.
+		return s.errorToken("invalid character in number")
 	}
 
 	// Read float.
 	if base == 10 && s.current() == '.' {
 		numberType = tokenFloat
 		s.advance()
-		if !readDigits() { // Ends with underscore or double underscore.
-			return s.errorToken("ERROR")
+		if !readDigits(false) { // Ends with underscore or double underscore.
+			return s.errorToken("invalid underscore in number")
 		} else if isAlpha(s.current()) { // '3.14abc' not allowed.
-			return s.errorToken("ERROR")
+			return s.errorToken("invalid character in number")
 		}
 	}
 
@@ -238,12 +265,12 @@ func (s *scanner) string() token {
 	var previous byte = eofByte
 	for !(s.current() == '"' && previous != '\\') && !s.isAtEnd() {
 		if s.current() == '\n' {
-			return s.errorToken("ERROR")
+			return s.errorToken("unterminated string")
 		}
 		previous = s.advance()
 	}
 	if s.isAtEnd() {
-		return s.errorToken("ERROR")
+		return s.errorToken("unterminated string")
 	}
 	s.advance() // Read ending '"'.
 	return s.makeToken(tokenString)
@@ -261,8 +288,8 @@ func isDigit(char byte, base int) bool {
 		return '0' <= char && char <= '0'+baseChar-1
 	}
 	return ('0' <= char && char <= '9') ||
-		('a' <= char && char <= 'a'+baseChar-1) ||
-		('A' <= char && char <= 'A'+baseChar-1)
+		('a' <= char && char <= 'a'+baseChar-11) ||
+		('A' <= char && char <= 'A'+baseChar-11)
 }
 
 func lowerChar(char byte) byte {
@@ -326,6 +353,7 @@ type dualSymbol [2]byte
 
 var dual = map[dualSymbol]tokenType{
 	{'<', '<'}: tokenLAngleAngle,
+	{'=', '>'}: tokenArrow,
 	{'>', '>'}: tokenRAngleAngle,
 	{'?', '.'}: tokenQuestDot,
 	{'?', '['}: tokenQuestLBrack,
@@ -390,6 +418,8 @@ var keywords = map[string]tokenType{
 	"default":  tokenDefault,
 	"async":    tokenAsync,
 	"await":    tokenAwait,
+	"class":    tokenClass,
+	"extends":  tokenExtends,
 
 	"typeof": tokenTypeOf,
 }
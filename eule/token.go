@@ -1,6 +1,9 @@
 package eule
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 type tokenType string
 
@@ -110,10 +113,19 @@ const (
 
 type token struct {
 	tokenType
-	line    int
+	pos
 	literal string
 }
 
+// end returns position after the last character of the token.
+func (t token) end() pos {
+	return pos{
+		line:   t.line,
+		col:    t.col + len(t.literal),
+		offset: t.offset + len(t.literal),
+	}
+}
+
 func (t token) String() string {
 	return fmt.Sprintf(
 		"%04d: %-12s '%s'",
@@ -122,3 +134,93 @@ func (t token) String() string {
 		shortString(t.literal, 32),
 	)
 }
+
+/* == source positions ====================================================== */
+
+// sourceFile is script text with its name, used for diagnostics.
+type sourceFile struct {
+	name string
+	text []byte
+}
+
+type pos struct {
+	line   int
+	col    int // Byte column starting from 1.
+	offset int // Byte offset from the file start.
+}
+
+type span struct {
+	file  *sourceFile
+	start pos
+	end   pos // Position after the last character.
+}
+
+// Position is location in the script source, it is reported by errors
+// for diagnostics and editor integration.
+type Position struct {
+	File   string // File name, "script" if it is unknown.
+	Line   int    // Line starting from 1.
+	Column int    // Byte column starting from 1.
+	Offset int    // Byte offset from the file start.
+}
+
+func (p Position) String() string {
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Column)
+}
+
+// Pos returns position of the first character of the span.
+func (s span) Pos() Position {
+	return s.position(s.start)
+}
+
+// End returns position after the last character of the span.
+func (s span) End() Position {
+	return s.position(s.end)
+}
+
+func (s span) position(at pos) Position {
+	name := "script"
+	if s.file != nil {
+		name = s.file.name
+	}
+	return Position{name, at.line, at.col, at.offset}
+}
+
+func (s span) String() string {
+	return s.Pos().String()
+}
+
+// excerpt returns the first line of the span with carets under it.
+func (s span) excerpt() string {
+	if s.file == nil || s.start.offset > len(s.file.text) {
+		return ""
+	}
+
+	text := s.file.text
+	lineStart := s.start.offset - (s.start.col - 1)
+	lineEnd := lineStart
+	for lineEnd < len(text) && text[lineEnd] != '\n' {
+		lineEnd++
+	}
+	line := strings.TrimRight(string(text[lineStart:lineEnd]), "\r")
+
+	width := 1
+	if s.end.line == s.start.line && s.end.col > s.start.col {
+		width = s.end.col - s.start.col
+	}
+
+	// Keeps tabs, so carets are aligned in terminal.
+	indent := []byte(line[:min(s.start.col-1, len(line))])
+	for i, char := range indent {
+		if char != '\t' {
+			indent[i] = ' '
+		}
+	}
+
+	return fmt.Sprintf(
+		"    %s\n    %s%s",
+		line,
+		indent,
+		strings.Repeat("^", width),
+	)
+}
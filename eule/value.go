@@ -3,6 +3,7 @@ package eule
 import (
 	"fmt"
 	"strconv"
+	"time"
 )
 
 type Value interface {
@@ -16,12 +17,16 @@ type Boolean bool
 type Number float64
 type String string
 type Closure struct {
-	closure env
+	name    string
+	closure *env
 	params  []varName
+	slots   int
 	block   block
+	code    *chunk // Compiled body, used by vm backend.
 }
 type Native struct {
-	fn func(it *Interpreter, args []Value) Value
+	name string
+	fn   NativeFunc
 }
 type Table struct {
 	Proto *Table
@@ -29,13 +34,80 @@ type Table struct {
 }
 type Future empty
 
-func nativePrint(it *Interpreter, args []Value) Value {
-	for _, arg := range args {
+// NativeFunc is Go function callable from scripts. Returned error is
+// thrown in script as its message string.
+type NativeFunc = func(it *Interpreter, args []Value) (Value, error)
+
+/* == constructors ========================================================== */
+
+func NewNihil() Nihil                { return Nihil{} }
+func NewBoolean(value bool) Boolean  { return Boolean(value) }
+func NewNumber(value float64) Number { return Number(value) }
+func NewString(value string) String  { return String(value) }
+
+func NewNative(name string, fn NativeFunc) *Native {
+	return &Native{name: name, fn: fn}
+}
+
+// NewTable returns empty table, proto can be nil.
+func NewTable(proto *Table) *Table {
+	return &Table{Proto: proto, Pairs: make(map[String]Value)}
+}
+
+// NewArray returns table with values stored at keys from 0.
+func NewArray(values ...Value) *Table {
+	tbl := NewTable(nil)
+	for i, value := range values {
+		tbl.store(String(Number(i).String()), value)
+	}
+	return tbl
+}
+
+/* == natives =============================================================== */
+
+func nativePrint(it *Interpreter, args []Value) (Value, error) {
+	for i, arg := range args {
+		if i != 0 {
+			fmt.Print(" ")
+		}
 		fmt.Print(arg)
-		fmt.Print(" ")
 	}
 	fmt.Println()
-	return Nihil{}
+	return Nihil{}, nil
+}
+
+// nativeClock returns seconds since the program start.
+func nativeClock(it *Interpreter, args []Value) (Value, error) {
+	return Number(time.Since(startTime).Seconds()), nil
+}
+
+var startTime = time.Now()
+
+// load looks the key up in the table and then in its prototype chain.
+func (t *Table) load(key String) Value {
+	value, _ := t.lookup(key)
+	return value
+}
+
+// lookup returns value of the key and table of the prototype chain that
+// holds it, holder is nil if key is not found.
+func (t *Table) lookup(key String) (value Value, holder *Table) {
+	for tbl := t; tbl != nil; tbl = tbl.Proto {
+		if value, ok := tbl.Pairs[key]; ok {
+			return value, tbl
+		}
+	}
+	return Nihil{}, nil
+}
+
+// store always writes to the table itself. Storing void deletes own pair,
+// so table has no void pairs and inherited value of the key is visible.
+func (t *Table) store(key String, value Value) {
+	if _, ok := value.(Nihil); ok {
+		delete(t.Pairs, key)
+		return
+	}
+	t.Pairs[key] = value
 }
 
 func testValue(v Value) bool {
@@ -0,0 +1,565 @@
+package eule
+
+import (
+	"fmt"
+	"slices"
+)
+
+type callFrame struct {
+	code *chunk
+	ip   int
+	base int  // Stack size before the call.
+	env  *env // Environment of the caller.
+}
+
+type handler struct {
+	frames  int // Frames count when handler was installed.
+	ip      int
+	stack   int
+	env     *env
+	finally bool // Gets pending error instead of thrown value.
+}
+
+// pendingError is error kept on the stack while finally block runs, so
+// rethrow keeps its position and trace.
+type pendingError struct {
+	err *RuntimeError
+}
+
+// vm is stack machine that runs compiled chunks. Variables live in the same
+// environments as in the tree-walking evaluator, instructions address them
+// by resolved scope distance and slot.
+type vm struct {
+	it       *Interpreter
+	stack    []Value
+	frames   []callFrame
+	handlers []handler
+	env      *env
+}
+
+func newVM(it *Interpreter) *vm {
+	return &vm{
+		it:       it,
+		stack:    make([]Value, 0, uint8Count),
+		frames:   make([]callFrame, 0, uint8Count),
+		handlers: make([]handler, 0),
+		env:      nil,
+	}
+}
+
+func (vm *vm) push(value Value) {
+	vm.stack = append(vm.stack, value)
+}
+
+func (vm *vm) pop() Value {
+	value := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return value
+}
+
+func (vm *vm) peek(distance int) Value {
+	return vm.stack[len(vm.stack)-1-distance]
+}
+
+func (vm *vm) runScript(script *chunk) (value Value, err error) {
+	defer catch(func(throw throwSignal) { value, err = nil, throw.err })
+	defer vm.restoreDepth(vm.it.depth)
+
+	return vm.run(script), nil
+}
+
+// callClosure calls closure from Go, its return ends the run.
+func (vm *vm) callClosure(
+	fn *Closure,
+	recv receiver,
+	args []Value,
+) (value Value, err error) {
+	defer catch(func(throw throwSignal) { value, err = nil, throw.err })
+	defer vm.restoreDepth(vm.it.depth)
+
+	vm.push(recv.this)
+	vm.push(recv.super)
+	vm.push(fn)
+	for _, arg := range args {
+		vm.push(arg)
+	}
+	vm.call(len(args), true)
+	return vm.execute(), nil
+}
+
+// restoreDepth resets call depth of the interpreter when the run leaves
+// the vm, frames left by uncaught throw are not returned.
+func (vm *vm) restoreDepth(depth int) {
+	vm.it.depth = depth
+}
+
+func (vm *vm) run(script *chunk) Value {
+	vm.frames = append(vm.frames, callFrame{
+		code: script,
+		ip:   0,
+		base: len(vm.stack),
+		env:  vm.env,
+	})
+	return vm.execute()
+}
+
+// execute runs the top frame until the bottom frame returns.
+func (vm *vm) execute() Value {
+	frame := &vm.frames[len(vm.frames)-1]
+	code := frame.code
+
+	readByte := func() int {
+		frame.ip++
+		return int(code.code[frame.ip-1])
+	}
+	readShort := func() int {
+		frame.ip += 2
+		return code.readShort(frame.ip - 2)
+	}
+	// Updates cached frame after calls, returns and throws.
+	loadFrame := func() {
+		frame = &vm.frames[len(vm.frames)-1]
+		code = frame.code
+	}
+	// Throws error of the failed instruction.
+	raise := func(err error) {
+		vm.raise(err)
+		loadFrame()
+	}
+
+	for {
+		switch op := opCode(readByte()); op {
+		case opConstant:
+			vm.push(code.constants[readShort()])
+		case opNihil:
+			vm.push(Nihil{})
+		case opTrue:
+			vm.push(Boolean(true))
+		case opFalse:
+			vm.push(Boolean(false))
+		case opPop:
+			vm.pop()
+		case opDup:
+			vm.push(vm.peek(0))
+		case opDup2:
+			vm.push(vm.peek(1))
+			vm.push(vm.peek(1))
+		case opBury:
+			depth := readByte()
+			top := len(vm.stack) - 1
+			value := vm.stack[top]
+			copy(vm.stack[top-depth+1:], vm.stack[top-depth:top])
+			vm.stack[top-depth] = value
+
+		case opDefineGlobal:
+			name := code.constants[readShort()].(String)
+			vm.it.global.Pairs[name] = vm.pop()
+		case opGetGlobal:
+			name := code.constants[readShort()].(String)
+			value, ok := vm.it.global.Pairs[name]
+			if !ok {
+				raise(fmt.Errorf("undefined variable '%s'", name))
+				break
+			}
+			vm.push(value)
+		case opSetGlobal:
+			name := code.constants[readShort()].(String)
+			if _, ok := vm.it.global.Pairs[name]; !ok {
+				raise(fmt.Errorf("undefined variable '%s'", name))
+				break
+			}
+			vm.it.global.Pairs[name] = vm.peek(0)
+		case opDefineLocal:
+			vm.env.slots[readByte()] = vm.pop()
+		case opGetLocal:
+			scope := vm.env.ancestor(readByte())
+			slot := readByte()
+			name := code.constants[readShort()]
+			value := scope.slots[slot]
+			if value == nil {
+				raise(fmt.Errorf("variable '%s' is not initialized", name))
+				break
+			}
+			vm.push(value)
+		case opSetLocal:
+			scope := vm.env.ancestor(readByte())
+			slot := readByte()
+			name := code.constants[readShort()]
+			if scope.slots[slot] == nil {
+				raise(fmt.Errorf("variable '%s' is not initialized", name))
+				break
+			}
+			scope.slots[slot] = vm.peek(0)
+
+		case opBeginScope:
+			vm.env = newEnv(vm.env, readByte())
+		case opEndScope:
+			vm.env = vm.env.encl
+
+		case opJump:
+			offset := readShort()
+			frame.ip += offset
+		case opJumpIfFalse:
+			offset := readShort()
+			if !testValue(vm.peek(0)) {
+				frame.ip += offset
+			}
+		case opJumpIfTrue:
+			offset := readShort()
+			if testValue(vm.peek(0)) {
+				frame.ip += offset
+			}
+		case opJumpNotNihil:
+			offset := readShort()
+			if _, ok := vm.peek(0).(Nihil); !ok {
+				frame.ip += offset
+			}
+		case opJumpIfNihil:
+			offset := readShort()
+			if _, ok := vm.peek(0).(Nihil); ok {
+				frame.ip += offset
+			}
+		case opLoop:
+			offset := readShort()
+			frame.ip -= offset
+		case opIterate:
+			iter, err := newIterator(vm.pop())
+			if err != nil {
+				raise(err)
+				break
+			}
+			vm.push(iter)
+		case opIterNext:
+			offset := readShort()
+			key, value, ok, err := vm.peek(0).(*iterator).next(vm.it, nil)
+			if err != nil {
+				raise(err)
+				break
+			}
+			if !ok {
+				frame.ip += offset
+				break
+			}
+			vm.push(key)
+			vm.push(value)
+
+		case opCall:
+			vm.call(readByte(), false)
+			loadFrame()
+		case opCallMethod:
+			vm.call(readByte(), true)
+			loadFrame()
+		case opClosure:
+			fn := code.functions[readShort()]
+			vm.push(&Closure{
+				name:    fn.name,
+				closure: vm.env,
+				params:  fn.params,
+				slots:   fn.slots,
+				code:    fn,
+			})
+		case opReturn:
+			value := vm.pop()
+			vm.env = frame.env
+			vm.stack = vm.stack[:frame.base]
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			vm.it.depth--
+			vm.dropHandlers()
+			if len(vm.frames) == 0 {
+				return value
+			}
+			vm.push(value)
+			loadFrame()
+
+		case opTable:
+			vm.push(&Table{Proto: nil, Pairs: make(map[String]Value)})
+		case opInherit:
+			table := vm.pop().(*Table)
+			if err := inherit(table, vm.pop()); err != nil {
+				raise(err)
+				break
+			}
+			vm.push(table)
+		case opInitIndex:
+			value := vm.pop()
+			key, err := tableKey(vm.pop())
+			if err != nil {
+				raise(err)
+				break
+			}
+			vm.peek(0).(*Table).store(key, value)
+		case opSpread:
+			value := vm.pop()
+			if err := spread(vm.peek(0).(*Table), value); err != nil {
+				raise(err)
+			}
+		case opGetMethod:
+			index := vm.pop()
+			object := vm.pop()
+			method, recv, err := loadMethod(object, index)
+			if err != nil {
+				raise(err)
+				break
+			}
+			vm.push(recv.super)
+			vm.push(method)
+		case opGetIndex:
+			index := vm.pop()
+			value, err := loadIndex(vm.pop(), index)
+			if err != nil {
+				raise(err)
+				break
+			}
+			vm.push(value)
+		case opSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			if err := storeIndex(vm.pop(), index, value); err != nil {
+				raise(err)
+				break
+			}
+			vm.push(value)
+
+		case opNegate, opPositive, opBitNot, opIncrement, opDecrement:
+			value, err := prefixOp(opPrefix[op], vm.pop())
+			if err != nil {
+				raise(err)
+				break
+			}
+			vm.push(value)
+		case opNot:
+			vm.push(Boolean(!testValue(vm.pop())))
+
+		case opAdd, opSubtract, opMultiply, opDivide, opModulo,
+			opBitOr, opBitXor, opBitAnd, opShiftLeft, opShiftRight,
+			opEqual, opNotEqual,
+			opLess, opLessEqual, opGreater, opGreaterEqual:
+			right := vm.pop()
+			value, err := infixOp(opInfix[op], vm.pop(), right)
+			if err != nil {
+				raise(err)
+				break
+			}
+			vm.push(value)
+
+		case opThrow:
+			value := vm.pop()
+			vm.throw(value.String(), value)
+			loadFrame()
+		case opRethrow:
+			vm.fail(vm.pop().(*pendingError).err)
+			loadFrame()
+		case opTry, opTryFinally:
+			offset := readShort()
+			vm.handlers = append(vm.handlers, handler{
+				frames:  len(vm.frames),
+				ip:      frame.ip + offset,
+				stack:   len(vm.stack),
+				env:     vm.env,
+				finally: op == opTryFinally,
+			})
+		case opEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+		default:
+			panic(unreachable)
+		}
+	}
+}
+
+// call calls value under the args, method receiver is under the callee.
+func (vm *vm) call(argc int, method bool) {
+	callee := len(vm.stack) - argc - 1
+	args := vm.stack[callee+1:]
+	base, recv := callee, noReceiver
+	if method {
+		base -= 2
+		recv = receiver{vm.stack[base], vm.stack[base+1]}
+	}
+
+	switch callee := vm.stack[callee].(type) {
+	case *Native:
+		value, err := callee.fn(vm.it, append([]Value{}, args...))
+		vm.stack = vm.stack[:base]
+		if err != nil {
+			vm.raiseNative(callee, err)
+			return
+		}
+		if value == nil {
+			value = Nihil{}
+		}
+		vm.push(value)
+	case *Closure:
+		if callee.code == nil { // Created by tree-walking backend.
+			value, err := vm.it.callMethod(callee, recv, slices.Clone(args))
+			vm.stack = vm.stack[:base]
+			if err != nil {
+				vm.raise(err)
+				return
+			}
+			vm.push(value)
+			return
+		}
+		if vm.it.depth >= callDepthMax {
+			vm.raise(errStackOverflow)
+			return
+		}
+		vm.it.depth++
+		env := newEnv(callee.closure, callee.slots)
+		loadArgs(env, callee.params, recv, args)
+		vm.stack = vm.stack[:base]
+		vm.frames = append(vm.frames, callFrame{
+			code: callee.code,
+			ip:   0,
+			base: base,
+			env:  vm.env,
+		})
+		vm.env = env
+	default:
+		vm.raise(fmt.Errorf("cannot call %s", callee.typeOf()))
+	}
+}
+
+// throw jumps to the innermost exception handler with thrown value on the
+// stack, uncaught value leaves the vm.
+func (vm *vm) throw(message string, value Value) {
+	if vm.catchesValue() {
+		vm.catch(value)
+		return
+	}
+	frame := vm.frames[len(vm.frames)-1]
+	vm.fail(&RuntimeError{
+		span:    frame.code.spans[frame.ip-1],
+		Message: message,
+		Value:   value,
+		Trace:   vm.trace(),
+	})
+}
+
+// rethrow throws error returned by the nested call, error keeps position
+// and trace of the nested call.
+func (vm *vm) rethrow(re *RuntimeError) {
+	if vm.catchesValue() {
+		vm.catch(re.Value)
+		return
+	}
+	err := *re
+	err.Trace = append(slices.Clip(re.Trace), vm.trace()...)
+	vm.fail(&err)
+}
+
+// fail throws error with complete trace, finally handler keeps the error,
+// uncaught error leaves the vm.
+func (vm *vm) fail(err *RuntimeError) {
+	switch {
+	case len(vm.handlers) == 0:
+		panic(throwSignal{err})
+	case vm.handlers[len(vm.handlers)-1].finally:
+		vm.catch(&pendingError{err})
+	default:
+		vm.catch(err.Value)
+	}
+}
+
+// catchesValue reports whether innermost handler needs only thrown value.
+func (vm *vm) catchesValue() bool {
+	return len(vm.handlers) != 0 && !vm.handlers[len(vm.handlers)-1].finally
+}
+
+// catch jumps to the innermost exception handler.
+func (vm *vm) catch(value Value) {
+	h := vm.handlers[len(vm.handlers)-1]
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+
+	vm.it.depth -= len(vm.frames) - h.frames
+	vm.frames = vm.frames[:h.frames]
+	vm.stack = vm.stack[:h.stack]
+	vm.env = h.env
+	vm.push(value)
+	vm.frames[len(vm.frames)-1].ip = h.ip
+}
+
+// raise throws failed operation error as its message string, runtime
+// errors returned by natives are rethrown.
+func (vm *vm) raise(err error) {
+	panicFault(err)
+	if re, ok := thrownError(err); ok {
+		vm.rethrow(re)
+		return
+	}
+	vm.throw(err.Error(), String(err.Error()))
+}
+
+// raiseNative throws error returned by the native, native is traced as
+// the innermost call like in tree-walking evaluator.
+func (vm *vm) raiseNative(fn *Native, err error) {
+	panicFault(err)
+	if re, ok := thrownError(err); ok {
+		// Native called functions from Go, its line is unknown.
+		err := *re
+		err.Trace = append(slices.Clip(re.Trace), TraceFrame{fn.name, 0})
+		vm.rethrow(&err)
+		return
+	}
+	frame := vm.frames[len(vm.frames)-1]
+	at := frame.code.spans[frame.ip-1]
+	vm.rethrow(&RuntimeError{
+		span:    at,
+		Message: err.Error(),
+		Value:   String(err.Error()),
+		Trace:   []TraceFrame{{fn.name, at.start.line}},
+	})
+}
+
+func (vm *vm) trace() []TraceFrame {
+	trace := make([]TraceFrame, 0, len(vm.frames))
+	for i := len(vm.frames) - 1; i >= 0; i-- {
+		frame := vm.frames[i]
+		line := frame.code.spans[frame.ip-1].start.line
+		trace = append(trace, TraceFrame{frame.code.name, line})
+	}
+	return trace
+}
+
+// dropHandlers removes handlers installed by returned frames.
+func (vm *vm) dropHandlers() {
+	for len(vm.handlers) != 0 &&
+		vm.handlers[len(vm.handlers)-1].frames > len(vm.frames) {
+		vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	}
+}
+
+var opPrefix = [...]tokenType{
+	opNegate:    tokenMinus,
+	opPositive:  tokenPlus,
+	opBitNot:    tokenTilde,
+	opIncrement: tokenPlusPlus,
+	opDecrement: tokenMinusMinus,
+}
+
+var opInfix = [...]tokenType{
+	opAdd:      tokenPlus,
+	opSubtract: tokenMinus,
+	opMultiply: tokenStar,
+	opDivide:   tokenSlash,
+	opModulo:   tokenPercent,
+
+	opBitOr:      tokenPipe,
+	opBitXor:     tokenCircum,
+	opBitAnd:     tokenAmper,
+	opShiftLeft:  tokenLAngleAngle,
+	opShiftRight: tokenRAngleAngle,
+
+	opEqual:        tokenEqEq,
+	opNotEqual:     tokenExclEq,
+	opLess:         tokenLAngle,
+	opLessEqual:    tokenLAngleEq,
+	opGreater:      tokenRAngle,
+	opGreaterEqual: tokenRAngleEq,
+}
+
+/* == interface ============================================================= */
+
+func (v *pendingError) valueMark()     {}
+func (v *pendingError) typeOf() String { return "error" }
+func (v *pendingError) String() string { return v.err.Message }
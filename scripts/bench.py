@@ -0,0 +1,51 @@
+#!/usr/bin/env python3
+
+# Runs *.eulb scripts on every backend and prints their output.
+#
+# usage: scripts/bench.py [path ...]
+
+import os
+import subprocess
+import sys
+import tempfile
+import time
+
+from lib import cover_string
+from test import BACKENDS, ROOT, build
+
+def collect(paths):
+	benchmarks = []
+	for path in paths:
+		if os.path.isfile(path):
+			benchmarks.append(path)
+			continue
+		for dir, _, files in os.walk(path):
+			for file in files:
+				if file.endswith(".eulb"):
+					benchmarks.append(os.path.join(dir, file))
+	return sorted(benchmarks)
+
+def main():
+	paths = sys.argv[1:] or [os.path.join(ROOT, "test", "benchmarks")]
+	benchmarks = collect(paths)
+
+	with tempfile.TemporaryDirectory() as dir:
+		binary = os.path.join(dir, "eule")
+		build(binary)
+
+		for benchmark in benchmarks:
+			print(cover_string(os.path.relpath(benchmark, ROOT), 80, "=", 1))
+			for backend in BACKENDS:
+				start = time.perf_counter()
+				result = subprocess.run(
+					[binary, *BACKENDS[backend], benchmark],
+					capture_output=True,
+					text=True,
+				)
+				elapsed = time.perf_counter() - start
+				print("{:<6} {:8.3f}s".format(backend, elapsed))
+				for line in (result.stdout + result.stderr).splitlines():
+					print("    " + line)
+
+if __name__ == "__main__":
+	main()
@@ -0,0 +1,130 @@
+#!/usr/bin/env python3
+
+# Runs *.eult scripts on every backend and compares output with
+# `// expect: value`, `// error: message` and `// trace: at f (line n)`
+# comments.
+#
+# usage: scripts/test.py [path ...]
+
+import os
+import re
+import subprocess
+import sys
+import tempfile
+
+from lib import cover_string
+
+ROOT = os.path.dirname(os.path.dirname(os.path.abspath(__file__)))
+BACKENDS = {
+	"tree": [],
+	"vm": ["-vm"],
+}
+
+# Tests in test/modes/<mode> run with options of the language mode, Go test
+# in eule/language_test.go lists the same modes.
+MODES = {
+	"arrow_functions": ["-arrow"],
+	"auto_semocolons": ["-semicolons"],
+	"object_oriented": ["-oop"],
+}
+
+EXPECT = re.compile(r"// expect: ?(.*)$")
+ERROR = re.compile(r"// error: ?(.*)$")
+TRACE = re.compile(r"// trace: ?(.*)$")
+
+def build(path):
+	subprocess.run(
+		["go", "build", "-o", path, "./cmd/eule"],
+		cwd=ROOT,
+		check=True,
+	)
+
+def collect(paths):
+	tests = []
+	for path in paths:
+		if os.path.isfile(path):
+			tests.append(path)
+			continue
+		for dir, _, files in os.walk(path):
+			for file in files:
+				if file.endswith(".eult"):
+					tests.append(os.path.join(dir, file))
+	return sorted(tests)
+
+def parse(test):
+	expected, errors, traces = [], [], []
+	with open(test) as file:
+		for line in file:
+			if match := EXPECT.search(line):
+				expected.append(match.group(1))
+			if match := ERROR.search(line):
+				errors.append(match.group(1))
+			if match := TRACE.search(line):
+				traces.append(match.group(1))
+	return expected, errors, traces
+
+def mode(test):
+	return MODES.get(os.path.basename(os.path.dirname(os.path.abspath(test))), [])
+
+def run(binary, backend, test):
+	expected, errors, traces = parse(test)
+	# Runs from the test directory, so diagnostics start with file name.
+	result = subprocess.run(
+		[binary, *BACKENDS[backend], *mode(test), os.path.basename(test)],
+		cwd=os.path.dirname(os.path.abspath(test)),
+		capture_output=True,
+		text=True,
+	)
+	output = result.stdout.splitlines()
+	failures = []
+
+	if output != expected:
+		failures.append("expected output:")
+		failures.extend("  " + line for line in expected)
+		failures.append("actual output:")
+		failures.extend("  " + line for line in output)
+
+	# Indented lines are source excerpts and traces.
+	messages = [l for l in result.stderr.splitlines() if not l.startswith(" ")]
+	for error in errors:
+		if not any(error in message for message in messages):
+			failures.append("expected error: " + error)
+	# Traces are checked only when the test lists them.
+	trace = [l.strip() for l in result.stderr.splitlines() if l.startswith("  at ")]
+	if traces and trace != traces:
+		failures.append("expected trace:")
+		failures.extend("  " + line for line in traces)
+		failures.append("actual trace:")
+		failures.extend("  " + line for line in trace)
+	if not errors and result.returncode != 0:
+		failures.append("unexpected error:")
+		failures.extend("  " + line for line in result.stderr.splitlines())
+
+	return failures
+
+def main():
+	paths = sys.argv[1:] or [os.path.join(ROOT, "test")]
+	tests = collect(paths)
+
+	with tempfile.TemporaryDirectory() as dir:
+		binary = os.path.join(dir, "eule")
+		build(binary)
+
+		passed, failed = 0, 0
+		for backend in BACKENDS:
+			print(cover_string(backend, 80, "=", 1))
+			for test in tests:
+				failures = run(binary, backend, test)
+				if failures:
+					failed += 1
+					print("FAIL", os.path.relpath(test, ROOT))
+					for failure in failures:
+						print("    " + failure)
+				else:
+					passed += 1
+
+	print(cover_string("{} passed, {} failed".format(passed, failed), 80, "=", 1))
+	sys.exit(1 if failed else 0)
+
+if __name__ == "__main__":
+	main()